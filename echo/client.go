@@ -1,16 +1,15 @@
 package echo
 
 import (
-	"fmt"
 	"net"
 	"os"
 	"time"
-
-	"github.com/charmbracelet/log"
 )
 
-func StreamingClient(addr string) error {
-	conn, err := net.Dial("unix", addr)
+func StreamingClient(network, addr string, opts ...option) error {
+	cfg := newConfig(opts)
+
+	conn, err := net.Dial(network, addr)
 	if err != nil {
 		return err
 	}
@@ -20,7 +19,7 @@ func StreamingClient(addr string) error {
 	msg := []byte("ping")
 
 	for i := 0; i < 3; i++ {
-		log.Info("client sending ping")
+		cfg.logger.Info("client sending ping")
 		_, err := conn.Write(msg)
 		if err != nil {
 			return err
@@ -31,13 +30,15 @@ func StreamingClient(addr string) error {
 		if err != nil {
 			return err
 		}
-		log.Info(fmt.Sprintf("client received %q", string(buf[:n])))
+		cfg.logger.Info("client received", "data", string(buf[:n]))
 		time.Sleep(1 * time.Second)
 	}
 	return nil
 }
 
-func DatagramClient(addr string, network string) error {
+func DatagramClient(addr string, network string, opts ...option) error {
+	cfg := newConfig(opts)
+
 	client, err := net.ListenPacket("unixgram", network)
 	if err != nil {
 		return err
@@ -45,21 +46,23 @@ func DatagramClient(addr string, network string) error {
 
 	defer func() { client.Close() }()
 
-	err = os.Chmod(network, os.ModeSocket|0666)
-	if err != nil {
-		return err
+	if path, onDisk := socketPath("unixgram", network); onDisk {
+		err = os.Chmod(path, os.ModeSocket|0666)
+		if err != nil {
+			return err
+		}
 	}
 
 	msg := []byte("ping")
 
 	sAddr, err := net.ResolveUnixAddr("unixgram", addr)
 	if err != nil {
-		log.Error(fmt.Sprintf("unable to resolve: %v", err))
+		cfg.logger.Error("unable to resolve", "addr", addr, "error", err)
 		return err
 	}
 
 	for i := 0; i < 3; i++ {
-		log.Info("client sending ping")
+		cfg.logger.Info("client sending ping")
 		_, err := client.WriteTo(msg, sAddr)
 		if err != nil {
 			return err
@@ -70,7 +73,7 @@ func DatagramClient(addr string, network string) error {
 		if err != nil {
 			return err
 		}
-		log.Info(fmt.Sprintf("client received %q", string(buf[:n])))
+		cfg.logger.Info("client received", "data", string(buf[:n]))
 		time.Sleep(1 * time.Second)
 	}
 	return nil
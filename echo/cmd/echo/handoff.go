@@ -0,0 +1,108 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/charmbracelet/log"
+	"github.com/jm96441n/networkProgrammingInGo/echo"
+)
+
+// runHandoff hands a listening tcp socket from one process to another, so
+// new connections are never refused in between. The giving process echoes
+// over tcpAddr until a taking process connects to socket, then sends it the
+// listener and exits, leaving the taker to echo over the same socket:
+//
+//	echo -handoff give -socket /tmp/handoff.sock -tcp 127.0.0.1:9000
+//	echo -handoff take -socket /tmp/handoff.sock
+func runHandoff(mode, socket, tcpAddr string) error {
+	if socket == "" {
+		return errors.New("-handoff requires -socket")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	switch mode {
+	case "give":
+		return give(ctx, socket, tcpAddr)
+	case "take":
+		return take(ctx, socket)
+	default:
+		return fmt.Errorf("unknown -handoff %q, expected give or take", mode)
+	}
+}
+
+func give(ctx context.Context, socket, tcpAddr string) error {
+	l, err := net.Listen("tcp", tcpAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	go serveEcho(l)
+	log.Info("echoing", "addr", l.Addr().String(), "pid", os.Getpid())
+
+	u, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	defer u.Close()
+	context.AfterFunc(ctx, func() { u.Close() })
+
+	log.Info("waiting for a process to take over", "socket", socket)
+	conn, err := u.AcceptUnix()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	defer conn.Close()
+
+	err = echo.SendListener(conn, l)
+	if err != nil {
+		return err
+	}
+	log.Info("handed off the listener, exiting")
+	return nil
+}
+
+func take(ctx context.Context, socket string) error {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	l, err := echo.ReceiveListener(conn)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	log.Info("took over", "addr", l.Addr().String(), "pid", os.Getpid())
+
+	go serveEcho(l)
+	<-ctx.Done()
+	return nil
+}
+
+// serveEcho echoes over each connection accepted from l until it is closed.
+func serveEcho(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		}()
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// runHandoff needs file descriptor passing, which only unix platforms have.
+func runHandoff(mode, socket, tcpAddr string) error {
+	return errors.New("-handoff is only supported on unix platforms")
+}
@@ -18,76 +18,68 @@ func main() {
 		clientMode bool
 		serverMode bool
 		clientAddr string
+		network    string
+		abstract   bool
+		handoff    string
+		socket     string
+		tcpAddr    string
 	)
 	flag.BoolVar(&clientMode, "c", false, "run in client mode")
 	flag.StringVar(&clientAddr, "a", "", "addr for client to reach server")
 	flag.BoolVar(&serverMode, "s", true, "run in client mode")
+	flag.StringVar(&network, "n", "unixgram", "network to echo over: unix, unixgram or unixpacket")
+	flag.BoolVar(&abstract, "abstract", false, "listen in the abstract namespace instead of on a socket file (Linux only)")
+	flag.StringVar(&handoff, "handoff", "", "give or take a listening tcp socket over the unix socket at -socket")
+	flag.StringVar(&socket, "socket", "", "unix socket to hand off the tcp socket over")
+	flag.StringVar(&tcpAddr, "tcp", "127.0.0.1:9000", "addr for the tcp socket to hand off")
 	flag.Parse()
 
-	if clientMode {
-		err := runClient(clientAddr)
+	if handoff != "" {
+		err := runHandoff(handoff, socket, tcpAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if clientMode {
+		err := runClient(network, clientAddr, abstract)
 		if err != nil {
 			log.Fatal(err)
 		}
 	} else {
-		err := runServer()
+		err := runServer(network, abstract)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 }
 
-func runServer() error {
-	// return runStreamingServer()
-	return runDatagramServer()
-}
+// socketAddr returns an address named after this process, in the abstract
+// namespace or in a temporary directory, along with a func removing that
+// directory.
+func socketAddr(abstract bool) (string, func(), error) {
+	name := fmt.Sprintf("%d.sock", os.Getpid())
+	if abstract {
+		return "@echo_unix/" + name, func() {}, nil
+	}
 
-func runStreamingServer() error {
 	dir, err := os.MkdirTemp("", "echo_unix")
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-
-	defer func() {
+	cleanup := func() {
 		rErr := os.RemoveAll(dir)
 		if rErr != nil {
 			log.Error(rErr)
 		}
-	}()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	sigs := make(chan os.Signal, 1)
-
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		sig := <-sigs
-		fmt.Println()
-		fmt.Println(sig)
-		cancel()
-	}()
-
-	socket := filepath.Join(dir, fmt.Sprintf("%d.sock", os.Getpid()))
-
-	_, err = echo.StreamingEchoServer(ctx, "unix", socket)
-	if err != nil {
-		return err
 	}
-
-	return nil
+	return filepath.Join(dir, name), cleanup, nil
 }
 
-func runDatagramServer() error {
-	dir, err := os.MkdirTemp("", "echo_unix")
+func runServer(network string, abstract bool) error {
+	socket, cleanup, err := socketAddr(abstract)
 	if err != nil {
 		return err
 	}
-
-	defer func() {
-		rErr := os.RemoveAll(dir)
-		if rErr != nil {
-			log.Error(rErr)
-		}
-	}()
+	defer cleanup()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	sigs := make(chan os.Signal, 1)
@@ -100,33 +92,22 @@ func runDatagramServer() error {
 		cancel()
 	}()
 
-	socket := filepath.Join(dir, fmt.Sprintf("%d.sock", os.Getpid()))
-
-	err = echo.DatagramEchoServer(ctx, "unixgram", socket)
-	if err != nil {
-		return err
+	if network == "unixgram" {
+		return echo.DatagramEchoServer(ctx, network, socket)
 	}
-
-	return nil
+	_, err = echo.StreamingEchoServer(ctx, network, socket)
+	return err
 }
 
-func runClient(addr string) error {
-	// return echo.StreamingClient(addr)
-	return runDatagramClient(addr)
-}
+func runClient(network, addr string, abstract bool) error {
+	if network != "unixgram" {
+		return echo.StreamingClient(network, addr)
+	}
 
-func runDatagramClient(addr string) error {
-	dir, err := os.MkdirTemp("", "echo_unix")
+	socket, cleanup, err := socketAddr(abstract)
 	if err != nil {
 		return err
 	}
-
-	defer func() {
-		rErr := os.RemoveAll(dir)
-		if rErr != nil {
-			log.Error(rErr)
-		}
-	}()
-	socket := filepath.Join(dir, fmt.Sprintf("%d.sock", os.Getpid()))
+	defer cleanup()
 	return echo.DatagramClient(addr, socket)
 }
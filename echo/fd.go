@@ -0,0 +1,147 @@
+//go:build unix
+
+package echo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var ErrTruncated = errors.New("ancillary data truncated, file descriptors were lost")
+
+// SendFiles sends msg over conn with duplicates of files' descriptors
+// attached as SCM_RIGHTS ancillary data. msg must not be empty, stream
+// sockets not delivering ancillary data without any bytes to go with it.
+// files remain open on this side, and can be closed once sent.
+func SendFiles(conn *net.UnixConn, msg []byte, files ...*os.File) error {
+	if len(msg) == 0 {
+		return errors.New("sending files requires a non-empty message")
+	}
+
+	return withFds(files, nil, func(fds []int) error {
+		n, oobn, err := conn.WriteMsgUnix(msg, syscall.UnixRights(fds...), nil)
+		if err != nil {
+			return err
+		}
+		if n != len(msg) {
+			return fmt.Errorf("short write: %d of %d bytes", n, len(msg))
+		}
+		if oobn == 0 && len(fds) > 0 {
+			return errors.New("file descriptors weren't sent")
+		}
+		return nil
+	})
+}
+
+// withFds calls fn with the descriptors of files appended to fds, each held
+// valid by its file until fn returns. Unlike File.Fd, it leaves the files in
+// non-blocking mode.
+func withFds(files []*os.File, fds []int, fn func(fds []int) error) error {
+	if len(files) == 0 {
+		return fn(fds)
+	}
+	raw, err := files[0].SyscallConn()
+	if err != nil {
+		return err
+	}
+	var fnErr error
+	err = raw.Control(func(fd uintptr) {
+		fnErr = withFds(files[1:], append(fds, int(fd)), fn)
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// ReceiveFiles reads a message sent with SendFiles into buf, returning the
+// number of bytes read and the files sent with it, making room for at least
+// max of them. If more were sent than fit, they are all closed and
+// ErrTruncated is returned. Every file returned is the caller's to close.
+func ReceiveFiles(conn *net.UnixConn, buf []byte, max int) (int, []*os.File, error) {
+	oob := make([]byte, syscall.CmsgSpace(max*4))
+	n, oobn, flags, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return n, nil, err
+	}
+
+	files, err := parseRights(oob[:oobn])
+	if err == nil && flags&syscall.MSG_CTRUNC != 0 {
+		err = ErrTruncated
+	}
+	if err != nil {
+		closeAll(files)
+		return n, nil, err
+	}
+	return n, files, nil
+}
+
+// parseRights returns the files in the SCM_RIGHTS messages of oob. If oob is
+// malformed, it returns the files found before that along with the error so
+// they can be closed.
+func parseRights(oob []byte) ([]*os.File, error) {
+	var files []*os.File
+	for len(oob) > 0 {
+		if len(oob) < syscall.SizeofCmsghdr {
+			return files, syscall.EINVAL
+		}
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&oob[0]))
+		size := int(h.Len) - syscall.CmsgLen(0)
+		if size < 0 || syscall.CmsgLen(size) > len(oob) {
+			return files, syscall.EINVAL
+		}
+		if h.Level == syscall.SOL_SOCKET && h.Type == syscall.SCM_RIGHTS {
+			data := oob[syscall.CmsgLen(0):syscall.CmsgLen(size)]
+			for ; len(data) >= 4; data = data[4:] {
+				fd := int(int32(binary.NativeEndian.Uint32(data)))
+				files = append(files, os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd)))
+			}
+		}
+		oob = oob[min(syscall.CmsgSpace(size), len(oob)):]
+	}
+	return files, nil
+}
+
+func closeAll(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
+
+// SendListener hands l to the process on the other end of conn, which gets
+// it with ReceiveListener. l keeps listening on this side until closed, so
+// both processes can accept connections in the meantime.
+func SendListener(conn *net.UnixConn, l net.Listener) error {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return fmt.Errorf("can't send a %T", l)
+	}
+	f, err := fl.File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return SendFiles(conn, []byte(l.Addr().Network()), f)
+}
+
+// ReceiveListener returns the listener sent with SendListener over conn.
+func ReceiveListener(conn *net.UnixConn) (net.Listener, error) {
+	buf := make([]byte, 64)
+	_, files, err := ReceiveFiles(conn, buf, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) != 1 {
+		closeAll(files)
+		return nil, fmt.Errorf("expected 1 file descriptor for a listener, got %d", len(files))
+	}
+
+	// the listener holds its own duplicate of the descriptor
+	defer files[0].Close()
+	return net.FileListener(files[0])
+}
@@ -0,0 +1,181 @@
+//go:build unix
+
+package echo_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/echo"
+)
+
+// unixPair returns both ends of a unix socket connection.
+func unixPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(t.TempDir(), "fd.sock"), Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	a, err := net.DialUnix("unix", nil, l.Addr().(*net.UnixAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.AcceptUnix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func TestSendFiles(t *testing.T) {
+	a, b := unixPair(t)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if err := echo.SendFiles(a, []byte("pipe"), w); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 16)
+	n, files, err := echo.ReceiveFiles(b, buf, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "pipe" || len(files) != 1 {
+		t.Fatalf("expected pipe with 1 file, got %q with %d", buf[:n], len(files))
+	}
+
+	// writing to the received end comes out of the original pipe
+	if _, err := files[0].Write([]byte("through")); err != nil {
+		t.Fatal(err)
+	}
+	files[0].Close()
+	w.Close()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "through" {
+		t.Errorf("expected through, got %q", got)
+	}
+}
+
+func TestSendFilesKeepsFilesNonBlocking(t *testing.T) {
+	a, b := unixPair(t)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if err := echo.SendFiles(a, []byte("pipe"), r); err != nil {
+		t.Fatal(err)
+	}
+	_, files, err := echo.ReceiveFiles(b, make([]byte, 16), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		f.Close()
+	}
+
+	// deadlines only work on files still in non-blocking mode, a blocked
+	// read waiting for the write instead
+	if err := r.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+		t.Fatalf("expected the sent file to take a deadline, got %v", err)
+	}
+	timer := time.AfterFunc(time.Second, func() { w.Write([]byte("x")) })
+	defer timer.Stop()
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the read to time out, got %v", err)
+	}
+}
+
+// openFiles returns the number of descriptors this process has open.
+func openFiles(t *testing.T) int {
+	t.Helper()
+	fds, err := os.ReadDir("/dev/fd")
+	if err != nil {
+		t.Skip("can't list open descriptors:", err)
+	}
+	return len(fds)
+}
+
+func TestReceiveFilesTruncated(t *testing.T) {
+	a, b := unixPair(t)
+
+	if err := echo.SendFiles(a, []byte("x"), os.Stdin, os.Stdout, os.Stderr, os.Stdin); err != nil {
+		t.Fatal(err)
+	}
+	before := openFiles(t)
+	if _, _, err := echo.ReceiveFiles(b, make([]byte, 1), 1); err != echo.ErrTruncated {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+	// the descriptors that did fit are closed rather than leaked
+	if after := openFiles(t); after != before {
+		t.Errorf("expected %d open descriptors, got %d", before, after)
+	}
+}
+
+func TestSendListener(t *testing.T) {
+	a, b := unixPair(t)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := echo.SendListener(a, l); err != nil {
+		t.Fatal(err)
+	}
+	// the receiving side now accepts alone
+	l.Close()
+
+	got, err := echo.ReceiveListener(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got.Addr().String() != l.Addr().String() {
+		t.Errorf("expected a listener on %s, got %s", l.Addr(), got.Addr())
+	}
+
+	go func() {
+		conn, err := got.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("handed off"))
+		conn.Close()
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	msg, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "handed off" {
+		t.Errorf("expected handed off, got %q", msg)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/jm96441n/networkProgrammingInGo/echo
 
-go 1.19
+go 1.21
 
 require github.com/charmbracelet/log v0.1.2
 
@@ -0,0 +1,65 @@
+package echo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+)
+
+var (
+	ErrPeerCredUnsupported = errors.New("peer credentials aren't supported on this platform")
+	ErrUnauthorized        = errors.New("peer isn't allowed to connect")
+)
+
+// Peer is the process on the other end of a unix socket, as the kernel saw
+// it when the connection was made.
+type Peer struct {
+	PID int
+	UID int
+	GID int
+}
+
+func (p Peer) String() string { return fmt.Sprintf("pid=%d uid=%d gid=%d", p.PID, p.UID, p.GID) }
+
+// PeerCred returns the credentials of the process on the other end of conn,
+// read with SO_PEERCRED.
+func PeerCred(conn *net.UnixConn) (Peer, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return Peer{}, err
+	}
+	return peerCred(raw)
+}
+
+type peerKey struct{}
+
+// PeerFromContext returns the peer a Server put in the context it passes its
+// handler, if the connection is over a unix socket.
+func PeerFromContext(ctx context.Context) (Peer, bool) {
+	p, ok := ctx.Value(peerKey{}).(Peer)
+	return p, ok
+}
+
+// Policy decides whether a peer may connect, returning an error if not.
+type Policy func(Peer) error
+
+// AllowUsers is a Policy letting in only peers running as one of uids.
+func AllowUsers(uids ...int) Policy {
+	return func(p Peer) error {
+		if !slices.Contains(uids, p.UID) {
+			return fmt.Errorf("%w: uid %d", ErrUnauthorized, p.UID)
+		}
+		return nil
+	}
+}
+
+// WithPolicy makes a Server close connections from peers policy rejects
+// before handing them to its handler. Connections whose peer credentials
+// can't be read, such as those over tcp, are rejected too.
+func WithPolicy(policy Policy) option {
+	return func(c *config) {
+		c.policy = policy
+	}
+}
@@ -0,0 +1,22 @@
+package echo
+
+import (
+	"syscall"
+)
+
+func peerCred(raw syscall.RawConn) (Peer, error) {
+	var (
+		cred *syscall.Ucred
+		err  error
+	)
+	cErr := raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if cErr != nil {
+		return Peer{}, cErr
+	}
+	if err != nil {
+		return Peer{}, err
+	}
+	return Peer{PID: int(cred.Pid), UID: int(cred.Uid), GID: int(cred.Gid)}, nil
+}
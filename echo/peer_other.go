@@ -0,0 +1,11 @@
+//go:build !linux
+
+package echo
+
+import (
+	"syscall"
+)
+
+func peerCred(syscall.RawConn) (Peer, error) {
+	return Peer{}, ErrPeerCredUnsupported
+}
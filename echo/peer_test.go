@@ -0,0 +1,70 @@
+package echo_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/echo"
+)
+
+func TestPeerCred(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+	s := echo.NewServer("unix", socket)
+	peers := make(chan echo.Peer, 1)
+	s.Handle(func(ctx context.Context, conn net.Conn) {
+		p, ok := echo.PeerFromContext(ctx)
+		if !ok {
+			t.Error("expected the peer in the handler's context")
+		}
+		peers <- p
+	})
+	start(t, s)
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	select {
+	case p := <-peers:
+		want := echo.Peer{PID: os.Getpid(), UID: os.Getuid(), GID: os.Getgid()}
+		if p != want {
+			t.Errorf("expected %v, got %v", want, p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler never ran")
+	}
+}
+
+func TestAllowUsers(t *testing.T) {
+	p := echo.Peer{UID: 1000}
+	if err := echo.AllowUsers(0, 1000)(p); err != nil {
+		t.Errorf("expected uid 1000 to be allowed, got %v", err)
+	}
+	if err := echo.AllowUsers(0)(p); !errors.Is(err, echo.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestPolicyRejectsPeer(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+	start(t, echo.NewServer("unix", socket, echo.WithPolicy(echo.AllowUsers(os.Getuid()+1))))
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected the server to close the connection, got %v", err)
+	}
+}
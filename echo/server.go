@@ -2,65 +2,293 @@ package echo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"os"
-
-	"github.com/charmbracelet/log"
+	"sync"
 )
 
-func StreamingEchoServer(ctx context.Context, network, addr string) (net.Addr, error) {
-	s, err := net.Listen(network, addr)
+type config struct {
+	logger   *slog.Logger
+	mode     os.FileMode // permissions for socket files, 0 leaves them as created
+	uid, gid int         // owner for socket files, -1 leaves it as created
+	policy   Policy      // who may connect to a Server, nil for anyone
+}
+
+type option func(*config)
+
+// WithLogger sets the logger used by the servers and clients in this package,
+// by default this is slog.Default().
+func WithLogger(l *slog.Logger) option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+// WithMode sets the permissions of the socket file a server listens on, such
+// as 0660 to let only the owner and group connect. By default the file keeps
+// the permissions it was created with, which depend on the umask.
+func WithMode(perm os.FileMode) option {
+	return func(c *config) {
+		c.mode = perm.Perm()
+	}
+}
+
+// WithOwner sets the owner and group of the socket file a server listens
+// on. Either can be -1 to leave it unchanged.
+func WithOwner(uid, gid int) option {
+	return func(c *config) {
+		c.uid, c.gid = uid, gid
+	}
+}
+
+func newConfig(opts []option) config {
+	c := config{logger: slog.Default(), uid: -1, gid: -1}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// Handler serves a connection accepted by a Server. ctx is canceled when the
+// server shuts down, and the connection is closed once Handler returns. For
+// unix sockets, ctx carries the Peer, see PeerFromContext.
+type Handler func(ctx context.Context, conn net.Conn)
+
+// Server serves connections on a stream or unixpacket socket, by default
+// echoing back whatever it reads, message by message over unixpacket. On unix
+// sockets it removes a stale socket file left behind at its address before
+// listening, and applies the permissions and owner set with WithMode and
+// WithOwner, none of which applies to addresses in the abstract namespace.
+type Server struct {
+	network string
+	addr    string
+	cfg     config
+	handler Handler
+
+	ready    chan struct{} // closed once listening
+	listener net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+}
+
+// NewServer returns a server for addr on network, such as unix, unixpacket or
+// tcp. On Linux, unix addresses starting with @ are in the abstract namespace.
+func NewServer(network, addr string, opts ...option) *Server {
+	return &Server{
+		network: network,
+		addr:    addr,
+		cfg:     newConfig(opts),
+		ready:   make(chan struct{}),
+		conns:   make(map[net.Conn]struct{}),
+	}
+}
+
+// Handle sets the handler for the connections the server accepts, in place
+// of echoing. It must be called before Serve.
+func (s *Server) Handle(h Handler) { s.handler = h }
+
+// Ready returns a channel that's closed once the server is listening. It is
+// never closed if Serve fails before then.
+func (s *Server) Ready() <-chan struct{} { return s.ready }
+
+// Addr returns the address the server is listening on, or nil before it is
+// ready.
+func (s *Server) Addr() net.Addr {
+	select {
+	case <-s.ready:
+		return s.listener.Addr()
+	default:
+		return nil
+	}
+}
+
+// Serve listens and serves connections until ctx is done, then closes the
+// connections still open and waits for their handlers to return before
+// returning nil.
+func (s *Server) Serve(ctx context.Context) error {
+	l, err := s.listen()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	s.listener = l
+	close(s.ready)
+	s.cfg.logger.Info("listening", "network", s.network, "addr", l.Addr().String())
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { _ = l.Close() })
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			cancel()
+			s.shutdown()
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		s.track(conn)
+		go s.serve(ctx, conn)
 	}
-	err = os.Chmod(addr, os.ModeSocket|0666)
+}
+
+func (s *Server) listen() (net.Listener, error) {
+	path, onDisk := socketPath(s.network, s.addr)
+	if onDisk {
+		err := removeStale(s.network, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen(s.network, s.addr)
 	if err != nil {
 		return nil, err
 	}
 
-	go func() {
-		for {
-			conn, err := s.Accept()
-			if err != nil {
-				return
-			}
+	if onDisk {
+		err = setupSocket(path, s.cfg)
+		if err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (s *Server) track(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	s.wg.Done()
+}
+
+// shutdown closes the connections still open and waits for their handlers.
+func (s *Server) shutdown() {
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
 
-			go func() {
-				defer func() { conn.Close() }()
-				for {
-					buf := make([]byte, 1024)
-					n, err := conn.Read(buf)
-					if err != nil {
-						log.Error(err)
-						return
-					}
-
-					log.Info(fmt.Sprintf("server received: %q", string(buf[:n])))
-					_, err = conn.Write(buf[:n])
-					if err != nil {
-						return
-					}
-				}
-			}()
+func (s *Server) serve(ctx context.Context, conn net.Conn) {
+	defer s.untrack(conn)
+	defer func() { _ = conn.Close() }()
+
+	ctx, err := s.authorize(ctx, conn)
+	if err != nil {
+		s.cfg.logger.Warn("rejected connection", "remote_addr", conn.RemoteAddr().String(), "error", err)
+		return
+	}
+
+	if s.handler != nil {
+		s.handler(ctx, conn)
+		return
+	}
+	s.echo(ctx, conn)
+}
+
+// authorize returns ctx carrying the peer on the other end of conn, or an
+// error if the server's policy rejects it.
+func (s *Server) authorize(ctx context.Context, conn net.Conn) (context.Context, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		if s.cfg.policy != nil {
+			return ctx, fmt.Errorf("%w: no peer credentials over %s", ErrUnauthorized, s.network)
 		}
-	}()
+		return ctx, nil
+	}
 
-	log.Info(fmt.Sprintf("listening on %q ....", s.Addr()))
-	<-ctx.Done()
-	s.Close()
+	peer, err := PeerCred(uc)
+	if err != nil {
+		if s.cfg.policy != nil {
+			return ctx, err
+		}
+		return ctx, nil
+	}
+	if s.cfg.policy != nil {
+		err = s.cfg.policy(peer)
+		if err != nil {
+			return ctx, err
+		}
+	}
+	return context.WithValue(ctx, peerKey{}, peer), nil
+}
+
+// echo writes back whatever it reads until the connection is closed.
+func (s *Server) echo(ctx context.Context, conn net.Conn) {
+	if uc, ok := conn.(*net.UnixConn); ok && s.network == "unixpacket" {
+		s.echoMessages(ctx, uc)
+		return
+	}
+
+	logger := s.cfg.logger.With("remote_addr", conn.RemoteAddr().String())
+	buf := make([]byte, 1024)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				logger.Error("read", "error", err)
+			}
+			return
+		}
 
-	return s.Addr(), nil
+		logger.Info("server received", "data", string(buf[:n]))
+		_, err = conn.Write(buf[:n])
+		if err != nil {
+			return
+		}
+	}
+}
+
+// StreamingEchoServer echoes what it reads from each connection to addr
+// until ctx is done. Unless set with WithMode, anyone may connect to the
+// socket file.
+func StreamingEchoServer(ctx context.Context, network, addr string, opts ...option) (net.Addr, error) {
+	s := NewServer(network, addr, append([]option{WithMode(0666)}, opts...)...)
+	err := s.Serve(ctx)
+	return s.Addr(), err
 }
 
-func DatagramEchoServer(ctx context.Context, network, addr string) error {
+func DatagramEchoServer(ctx context.Context, network, addr string, opts ...option) error {
+	cfg := newConfig(append([]option{WithMode(0666)}, opts...))
+
+	path, onDisk := socketPath(network, addr)
+	if onDisk {
+		err := removeStale(network, path)
+		if err != nil {
+			return err
+		}
+	}
+
 	s, err := net.ListenPacket(network, addr)
 	if err != nil {
 		return err
 	}
-	err = os.Chmod(addr, os.ModeSocket|0666)
-	if err != nil {
-		return err
+	if onDisk {
+		err = setupSocket(path, cfg)
+		if err != nil {
+			s.Close()
+			return err
+		}
 	}
 
 	go func() {
@@ -68,23 +296,23 @@ func DatagramEchoServer(ctx context.Context, network, addr string) error {
 		for {
 			n, clientAddr, err := s.ReadFrom(buf)
 			if err != nil {
-				log.Error(err)
+				cfg.logger.Error("read", "error", err)
 				return
 			}
 
 			_, err = s.WriteTo(buf[:n], clientAddr)
 			if err != nil {
-				log.Error(err)
+				cfg.logger.Error("write", "remote_addr", clientAddr.String(), "error", err)
 				return
 			}
 		}
 	}()
 
-	log.Info(fmt.Sprintf("listening on %q ....", s.LocalAddr()))
+	cfg.logger.Info("listening", "addr", s.LocalAddr().String())
 	<-ctx.Done()
 	s.Close()
-	if network == "unixgram" {
-		os.Remove(addr)
+	if onDisk {
+		os.Remove(path)
 	}
 	return nil
 }
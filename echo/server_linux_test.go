@@ -0,0 +1,133 @@
+package echo_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/echo"
+)
+
+func TestServerAbstract(t *testing.T) {
+	addr := fmt.Sprintf("@echo_test/%d", os.Getpid())
+	s := echo.NewServer("unix", addr, echo.WithMode(0600))
+	start(t, s)
+
+	conn, err := net.Dial("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := conn.Read(buf); err != nil || string(buf) != "ping" {
+		t.Errorf("expected ping, got %q, %v", buf, err)
+	}
+}
+
+func TestDatagramEchoServerAbstract(t *testing.T) {
+	addr := fmt.Sprintf("@echo_test/%d.gram", os.Getpid())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- echo.DatagramEchoServer(ctx, "unixgram", addr) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	client, err := net.ListenPacket("unixgram", addr+".client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	_ = client.SetDeadline(time.Now().Add(time.Second))
+
+	server := &net.UnixAddr{Name: addr, Net: "unixgram"}
+	buf := make([]byte, 4)
+	for {
+		// the server may not be bound yet
+		if _, err := client.WriteTo([]byte("ping"), server); err != nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		if _, _, err := client.ReadFrom(buf); err != nil {
+			t.Fatal(err)
+		}
+		break
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected ping, got %q", buf)
+	}
+}
+
+func TestServerUnixpacketKeepsMessageBoundaries(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+	start(t, echo.NewServer("unixpacket", socket))
+
+	conn, err := net.Dial("unixpacket", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	msgs := [][]byte{[]byte("one"), []byte("two"), bytes.Repeat([]byte{'x'}, 4000)}
+	for _, msg := range msgs {
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, 8192)
+	for _, want := range msgs {
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Errorf("expected a %d byte message, got %d bytes", len(want), n)
+		}
+	}
+}
+
+func TestServerUnixpacketEndsSessionOnEmptyMessage(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+	start(t, echo.NewServer("unixpacket", socket))
+
+	conn, err := net.Dial("unixpacket", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	if _, err := conn.Write([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "one" {
+		t.Errorf("expected one, got %q", buf[:n])
+	}
+
+	// the empty message can't be told from the connection closing
+	if _, err := conn.Write(nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := conn.Read(buf); err != io.EOF {
+		t.Errorf("expected io.EOF after the empty message, got %q and %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package echo
+
+import (
+	"context"
+	"net"
+)
+
+// echoMessages only logs an error, unixpacket sockets being supported on unix
+// platforms alone. conn is left to the caller to close.
+func (s *Server) echoMessages(ctx context.Context, conn *net.UnixConn) {
+	s.cfg.logger.Error("unixpacket isn't supported on this platform")
+}
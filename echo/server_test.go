@@ -0,0 +1,135 @@
+package echo_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/echo"
+)
+
+// start runs s until the test ends, waiting for it to be ready.
+func start(t *testing.T, s *echo.Server) <-chan error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	select {
+	case <-s.Ready():
+	case err := <-done:
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("server never became ready")
+	}
+	return done
+}
+
+func TestServerEchoes(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+	s := echo.NewServer("unix", socket, echo.WithMode(0600))
+	start(t, s)
+
+	fi, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %v", fi.Mode().Perm())
+	}
+
+	conn, err := net.Dial("unix", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Errorf("expected ping, got %q", buf)
+	}
+}
+
+func TestServerRemovesStaleSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+
+	// leave a socket file behind with nothing listening on it
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.SetUnlinkOnClose(false)
+	l.Close()
+
+	start(t, echo.NewServer("unix", socket))
+}
+
+func TestServerRefusesSocketInUse(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	err = echo.NewServer("unix", socket).Serve(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("expected an error for a socket in use, got %v", err)
+	}
+}
+
+func TestServerClosesConnectionsOnShutdown(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "echo.sock")
+	s := echo.NewServer("unix", socket)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx) }()
+	<-s.Ready()
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// round trip once, so the server is tracking the connection
+	if _, err := conn.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve didn't return after shutdown")
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected io.EOF once the server shut down, got %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("expected the socket file to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package echo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+// maxMessageSize is the largest message echoed over unixpacket.
+const maxMessageSize = 64 << 10
+
+// echoMessages writes back each message it reads as a message of its own,
+// for unixpacket sockets which keep the boundaries between them. Messages
+// too large to echo whole are dropped. An empty message reads the same as the
+// peer closing the connection, and so ends the session.
+func (s *Server) echoMessages(ctx context.Context, conn *net.UnixConn) {
+	logger := s.cfg.logger.With("remote_addr", conn.RemoteAddr().String())
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, flags, _, err := conn.ReadMsgUnix(buf, nil)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+				logger.Error("read", "error", err)
+			}
+			return
+		}
+		if n == 0 && flags == 0 {
+			return // the peer closed the connection, or sent an empty message
+		}
+		if flags&syscall.MSG_TRUNC != 0 {
+			logger.Warn("dropped a message over the size limit", "limit", maxMessageSize)
+			continue
+		}
+
+		logger.Info("server received", "data", string(buf[:n]))
+		_, err = conn.Write(buf[:n])
+		if err != nil {
+			return
+		}
+	}
+}
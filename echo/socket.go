@@ -0,0 +1,65 @@
+package echo
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// socketPath returns the file backing addr on network, if there is one.
+// Addresses in the Linux abstract namespace, which start with @, have none
+// and are gone as soon as they are closed.
+func socketPath(network, addr string) (string, bool) {
+	if !strings.HasPrefix(network, "unix") || addr == "" || isAbstract(addr) {
+		return "", false
+	}
+	return addr, true
+}
+
+func isAbstract(addr string) bool { return strings.HasPrefix(addr, "@") }
+
+// removeStale removes the socket file at path if nothing is listening on it,
+// as is left behind by a server that didn't shut down cleanly. It refuses to
+// remove anything that isn't a socket, or a socket that is still in use.
+func removeStale(network, path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s exists and isn't a socket", path)
+	}
+
+	conn, err := net.DialTimeout(network, path, time.Second)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("%s is in use", path)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// setupSocket applies the permissions and owner from cfg to the socket file
+// at path.
+func setupSocket(path string, cfg config) error {
+	if cfg.mode != 0 {
+		err := os.Chmod(path, os.ModeSocket|cfg.mode)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.uid != -1 || cfg.gid != -1 {
+		return os.Chown(path, cfg.uid, cfg.gid)
+	}
+	return nil
+}
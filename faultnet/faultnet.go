@@ -0,0 +1,344 @@
+// Package faultnet wraps net.PacketConn and datagram oriented net.Conn values
+// so that tests can inject loss, duplication, reordering and delay without
+// leaving the process.
+//
+// Faults are decided by a seeded random number generator so that a failing
+// test can be replayed with the same seed. Faults are applied to both reads
+// and writes, wrapping only one end of a conversation is enough to disturb
+// traffic in both directions.
+package faultnet
+
+import (
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config describes which faults to inject. Probabilities are in the range
+// [0, 1] and are rolled independently for every datagram.
+type Config struct {
+	Seed      int64         // seed for the random number generator
+	Loss      float64       // probability a datagram is dropped
+	Duplicate float64       // probability a datagram is delivered twice
+	Reorder   float64       // probability a datagram is held back and delivered after the next one, see HoldTimeout
+	Delay     time.Duration // upper bound of the random delay added to each datagram
+}
+
+// HoldTimeout is how long a datagram held back for reordering waits for the
+// next one before it is sent, or handed to the reader, anyway, so that
+// reordering the last datagram doesn't turn into losing it.
+const HoldTimeout = 10 * time.Millisecond
+
+// Stats counts the faults injected so far.
+type Stats struct {
+	Dropped    uint64
+	Duplicated uint64
+	Reordered  uint64
+	Delayed    uint64
+}
+
+type packet struct {
+	b    []byte
+	addr net.Addr
+}
+
+func newPacket(p []byte, addr net.Addr) packet {
+	return packet{b: append([]byte(nil), p...), addr: addr}
+}
+
+type faults struct {
+	cfg Config
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	dropped    atomic.Uint64
+	duplicated atomic.Uint64
+	reordered  atomic.Uint64
+	delayed    atomic.Uint64
+
+	readMu  sync.Mutex
+	pending []packet // packets to hand to the next reads before touching the wire
+
+	deadlineMu   sync.Mutex
+	readDeadline time.Time // the read deadline set by the caller
+
+	writeMu   sync.Mutex
+	held      *packet                             // a write held back until the next write goes out
+	heldWrite func([]byte, net.Addr) (int, error) // sends held
+	heldTimer *time.Timer                         // sends held after HoldTimeout
+}
+
+func newFaults(cfg Config) *faults {
+	return &faults{
+		cfg: cfg,
+		rng: rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+func (f *faults) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.rngMu.Lock()
+	defer f.rngMu.Unlock()
+	return f.rng.Float64() < p
+}
+
+func (f *faults) delay() time.Duration {
+	if f.cfg.Delay <= 0 {
+		return 0
+	}
+	f.rngMu.Lock()
+	defer f.rngMu.Unlock()
+	return time.Duration(f.rng.Int63n(int64(f.cfg.Delay)))
+}
+
+func (f *faults) stats() Stats {
+	return Stats{
+		Dropped:    f.dropped.Load(),
+		Duplicated: f.duplicated.Load(),
+		Reordered:  f.reordered.Load(),
+		Delayed:    f.delayed.Load(),
+	}
+}
+
+// read pulls datagrams off the wire with readFn, applying faults before
+// handing one back to the caller. While a datagram is held, the read deadline
+// is brought forward with setDeadline so the held datagram is handed back
+// after HoldTimeout if nothing else arrives.
+func (f *faults) read(p []byte, readFn func([]byte) (int, net.Addr, error), setDeadline func(time.Time) error) (int, net.Addr, error) {
+	f.readMu.Lock()
+	defer f.readMu.Unlock()
+
+	var held *packet
+	defer func() {
+		if held != nil {
+			f.restoreDeadline(setDeadline)
+		}
+	}()
+
+	for {
+		if len(f.pending) > 0 {
+			pkt := f.pending[0]
+			f.pending = f.pending[1:]
+			return copy(p, pkt.b), pkt.addr, nil
+		}
+
+		n, addr, err := readFn(p)
+		if err != nil {
+			if held != nil {
+				// nothing came along to overtake the held datagram, give it
+				// up rather than lose it
+				return copy(p, held.b), held.addr, nil
+			}
+			return n, addr, err
+		}
+
+		switch {
+		case f.roll(f.cfg.Loss):
+			f.dropped.Add(1)
+			continue
+		case held == nil && f.roll(f.cfg.Reorder):
+			f.reordered.Add(1)
+			pkt := newPacket(p[:n], addr)
+			held = &pkt
+			f.holdDeadline(setDeadline)
+			continue
+		case f.roll(f.cfg.Duplicate):
+			f.duplicated.Add(1)
+			f.pending = append(f.pending, newPacket(p[:n], addr))
+		}
+
+		if held != nil {
+			f.pending = append(f.pending, *held)
+		}
+
+		if d := f.delay(); d > 0 {
+			f.delayed.Add(1)
+			time.Sleep(d)
+		}
+
+		return n, addr, nil
+	}
+}
+
+// setReadDeadline records t as the caller's read deadline and sets it with
+// setFn.
+func (f *faults) setReadDeadline(t time.Time, setFn func(time.Time) error) error {
+	f.deadlineMu.Lock()
+	defer f.deadlineMu.Unlock()
+	f.readDeadline = t
+	return setFn(t)
+}
+
+// holdDeadline sets the read deadline to HoldTimeout from now, unless the
+// caller's is sooner.
+func (f *faults) holdDeadline(setFn func(time.Time) error) {
+	f.deadlineMu.Lock()
+	defer f.deadlineMu.Unlock()
+	t := time.Now().Add(HoldTimeout)
+	if !f.readDeadline.IsZero() && f.readDeadline.Before(t) {
+		t = f.readDeadline
+	}
+	_ = setFn(t)
+}
+
+// restoreDeadline puts back the caller's read deadline.
+func (f *faults) restoreDeadline(setFn func(time.Time) error) {
+	f.deadlineMu.Lock()
+	defer f.deadlineMu.Unlock()
+	_ = setFn(f.readDeadline)
+}
+
+// write sends p with writeFn, applying faults on the way out. Dropped and
+// held datagrams are reported as written in full, the same as a datagram
+// lost somewhere on the network.
+func (f *faults) write(p []byte, addr net.Addr, writeFn func([]byte, net.Addr) (int, error)) (int, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if f.roll(f.cfg.Loss) {
+		f.dropped.Add(1)
+		return len(p), nil
+	}
+
+	if f.held == nil && f.roll(f.cfg.Reorder) {
+		f.reordered.Add(1)
+		pkt := newPacket(p, addr)
+		f.held, f.heldWrite = &pkt, writeFn
+		f.heldTimer = time.AfterFunc(HoldTimeout, func() { f.flush(&pkt) })
+		return len(p), nil
+	}
+
+	out := []packet{newPacket(p, addr)}
+	if f.held != nil {
+		f.heldTimer.Stop()
+		out = append(out, *f.held)
+		f.held = nil
+	}
+	if f.roll(f.cfg.Duplicate) {
+		f.duplicated.Add(1)
+		out = append(out, out[0])
+	}
+
+	if d := f.delay(); d > 0 {
+		f.delayed.Add(1)
+		time.AfterFunc(d, func() {
+			for _, pkt := range out {
+				_, _ = writeFn(pkt.b, pkt.addr)
+			}
+		})
+		return len(p), nil
+	}
+
+	for i, pkt := range out {
+		n, err := writeFn(pkt.b, pkt.addr)
+		if i == 0 && err != nil {
+			return n, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// flush sends the held write if it is pkt, or whatever is held if pkt is
+// nil.
+func (f *faults) flush(pkt *packet) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if f.held == nil || pkt != nil && f.held != pkt {
+		return
+	}
+	f.heldTimer.Stop()
+	_, _ = f.heldWrite(f.held.b, f.held.addr)
+	f.held = nil
+}
+
+// PacketConn is a net.PacketConn that injects faults into the datagrams
+// passing through it.
+type PacketConn struct {
+	net.PacketConn
+	faults *faults
+}
+
+// NewPacketConn wraps conn so that reads and writes are subject to the faults
+// described by cfg.
+func NewPacketConn(conn net.PacketConn, cfg Config) *PacketConn {
+	return &PacketConn{PacketConn: conn, faults: newFaults(cfg)}
+}
+
+func (c *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	return c.faults.read(p, c.PacketConn.ReadFrom, c.PacketConn.SetReadDeadline)
+}
+
+func (c *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return c.faults.write(p, addr, c.PacketConn.WriteTo)
+}
+
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	return c.faults.setReadDeadline(t, c.PacketConn.SetDeadline)
+}
+
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	return c.faults.setReadDeadline(t, c.PacketConn.SetReadDeadline)
+}
+
+// Close sends any write held back for reordering, then closes the
+// connection.
+func (c *PacketConn) Close() error {
+	c.faults.flush(nil)
+	return c.PacketConn.Close()
+}
+
+// Stats returns the number of faults injected so far.
+func (c *PacketConn) Stats() Stats { return c.faults.stats() }
+
+// Conn is a net.Conn that injects faults into the data passing through it.
+// Every Read and Write is treated as a single datagram, so it is only suited
+// to datagram oriented connections such as a connected UDP socket.
+type Conn struct {
+	net.Conn
+	faults *faults
+}
+
+// NewConn wraps conn so that reads and writes are subject to the faults
+// described by cfg.
+func NewConn(conn net.Conn, cfg Config) *Conn {
+	return &Conn{Conn: conn, faults: newFaults(cfg)}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, _, err := c.faults.read(p, func(b []byte) (int, net.Addr, error) {
+		n, err := c.Conn.Read(b)
+		return n, nil, err
+	}, c.Conn.SetReadDeadline)
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.faults.write(p, nil, func(b []byte, _ net.Addr) (int, error) {
+		return c.Conn.Write(b)
+	})
+}
+
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.faults.setReadDeadline(t, c.Conn.SetDeadline)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.faults.setReadDeadline(t, c.Conn.SetReadDeadline)
+}
+
+// Close sends any write held back for reordering, then closes the
+// connection.
+func (c *Conn) Close() error {
+	c.faults.flush(nil)
+	return c.Conn.Close()
+}
+
+// Stats returns the number of faults injected so far.
+func (c *Conn) Stats() Stats { return c.faults.stats() }
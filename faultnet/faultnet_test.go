@@ -0,0 +1,230 @@
+package faultnet_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/faultnet"
+)
+
+func newPair(t *testing.T, cfg faultnet.Config) (*faultnet.PacketConn, net.PacketConn) {
+	t.Helper()
+
+	a, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+
+	b, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	return faultnet.NewPacketConn(a, cfg), b
+}
+
+// receive reads datagrams from conn until nothing arrives for a short while.
+func receive(t *testing.T, conn net.PacketConn) []string {
+	t.Helper()
+
+	var got []string
+	buf := make([]byte, 64)
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			var nErr net.Error
+			if errors.As(err, &nErr) && nErr.Timeout() {
+				return got
+			}
+			t.Fatal(err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+}
+
+func TestPacketConnWriteFaults(t *testing.T) {
+	msgs := []string{"a", "b", "c", "d"}
+
+	tests := []struct {
+		name string
+		cfg  faultnet.Config
+		want []string
+	}{
+		{name: "clean", want: msgs},
+		{name: "loss", cfg: faultnet.Config{Loss: 1}, want: nil},
+		{name: "duplicate", cfg: faultnet.Config{Duplicate: 1}, want: []string{"a", "a", "b", "b", "c", "c", "d", "d"}},
+		{name: "reorder", cfg: faultnet.Config{Reorder: 1}, want: []string{"b", "a", "d", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			faulty, peer := newPair(t, tt.cfg)
+
+			for _, msg := range msgs {
+				_, err := faulty.WriteTo([]byte(msg), peer.LocalAddr())
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got := receive(t, peer)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %q, got %q", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPacketConnSendsHeldWrites(t *testing.T) {
+	faulty, peer := newPair(t, faultnet.Config{Reorder: 1})
+
+	// nothing follows c, so it goes out once it has been held long enough
+	for _, msg := range []string{"a", "b", "c"} {
+		if _, err := faulty.WriteTo([]byte(msg), peer.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := receive(t, peer)
+	if len(got) != 3 || got[0] != "b" || got[1] != "a" || got[2] != "c" {
+		t.Fatalf(`expected ["b" "a" "c"], got %q`, got)
+	}
+
+	// and closing sends it straight away
+	if _, err := faulty.WriteTo([]byte("last"), peer.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if err := faulty.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got = receive(t, peer)
+	if len(got) != 1 || got[0] != "last" {
+		t.Fatalf(`expected ["last"], got %q`, got)
+	}
+}
+
+func TestPacketConnReadFaults(t *testing.T) {
+	faulty, peer := newPair(t, faultnet.Config{Duplicate: 1})
+
+	_, err := peer.WriteTo([]byte("ping"), faulty.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := receive(t, faulty)
+	if len(got) != 2 || got[0] != "ping" || got[1] != "ping" {
+		t.Fatalf(`expected ["ping" "ping"], got %q`, got)
+	}
+
+	if s := faulty.Stats(); s.Duplicated != 1 {
+		t.Errorf("expected 1 duplicated datagram, got %d", s.Duplicated)
+	}
+}
+
+func TestPacketConnHandsOverHeldReads(t *testing.T) {
+	faulty, peer := newPair(t, faultnet.Config{Reorder: 1})
+
+	// nothing follows ping, and the read has no deadline of its own
+	_, err := peer.WriteTo([]byte("ping"), faulty.LocalAddr())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _, err := faulty.ReadFrom(buf)
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		got <- string(buf[:n])
+
+		// the deadline brought forward for the held datagram is lifted
+		_, _ = peer.WriteTo([]byte("pong"), faulty.LocalAddr())
+		n, _, err = faulty.ReadFrom(buf)
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		got <- string(buf[:n])
+	}()
+
+	for _, want := range []string{"ping", "pong"} {
+		select {
+		case msg := <-got:
+			if msg != want {
+				t.Fatalf("expected %q, got %q", want, msg)
+			}
+		case <-time.After(time.Second):
+			_ = faulty.Close()
+			t.Fatalf("expected %q, read is still blocked", want)
+		}
+	}
+}
+
+func TestPacketConnIsDeterministicForASeed(t *testing.T) {
+	cfg := faultnet.Config{Seed: 42, Loss: 0.5}
+
+	run := func() []string {
+		faulty, peer := newPair(t, cfg)
+		for i := 0; i < 32; i++ {
+			_, err := faulty.WriteTo([]byte{byte('A' + i)}, peer.LocalAddr())
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return receive(t, peer)
+	}
+
+	first, second := run(), run()
+	if len(first) == 0 || len(first) == 32 {
+		t.Fatalf("expected some but not all datagrams to be lost, got %d", len(first))
+	}
+	if len(first) != len(second) {
+		t.Fatalf("expected the same datagrams for the same seed, got %q and %q", first, second)
+	}
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same datagrams for the same seed, got %q and %q", first, second)
+		}
+	}
+}
+
+func TestConnDelaysWrites(t *testing.T) {
+	peer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = peer.Close() }()
+
+	conn, err := net.Dial("udp", peer.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := faultnet.NewConn(conn, faultnet.Config{Seed: 1, Delay: 50 * time.Millisecond})
+	defer func() { _ = c.Close() }()
+
+	_, err = c.Write([]byte("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := receive(t, peer)
+	if len(got) != 1 || got[0] != "ping" {
+		t.Fatalf(`expected ["ping"], got %q`, got)
+	}
+	if s := c.Stats(); s.Delayed != 1 {
+		t.Errorf("expected 1 delayed datagram, got %d", s.Delayed)
+	}
+}
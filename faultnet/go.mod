@@ -0,0 +1,3 @@
+module github.com/jm96441n/networkProgrammingInGo/faultnet
+
+go 1.21
@@ -0,0 +1,204 @@
+package tftp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+type Client struct {
+	Retries uint8         // number of times to retry before giving up on the server
+	Timeout time.Duration // the duration to wait for a data packet
+
+	logger *slog.Logger
+}
+
+type clientOption func(*Client)
+
+func NewClient(opts ...clientOption) Client {
+	c := Client{
+		Retries: 10,
+		Timeout: 6 * time.Second,
+		logger:  slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func WithClientRetries(r uint8) clientOption {
+	return func(c *Client) {
+		c.Retries = r
+	}
+}
+
+func WithClientTimeout(t time.Duration) clientOption {
+	return func(c *Client) {
+		c.Timeout = t
+	}
+}
+
+// WithClientLogger sets the logger used by the client, by default this is
+// slog.Default().
+func WithClientLogger(l *slog.Logger) clientOption {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+func (c Client) log() *slog.Logger {
+	if c.logger == nil {
+		return slog.Default()
+	}
+	return c.logger
+}
+
+// Get requests filename from the server listening on addr and returns its
+// contents. The transfer is run over conn, which must not be shared with
+// another transfer while Get is running.
+func (c Client) Get(conn net.PacketConn, addr net.Addr, filename string) ([]byte, error) {
+	if conn == nil {
+		return nil, errors.New("nil connection")
+	}
+
+	logger := c.log().With("remote_addr", addr.String(), "filename", filename)
+
+	rrq, err := ReadReq{Filename: filename}.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		file     bytes.Buffer
+		next     = rrq  // the packet to (re)send until the server answers
+		nextAddr = addr // the server answers from a new address (its TID) once the transfer starts
+		tid      net.Addr
+		block    uint16 = 1 // the block we are waiting for
+	)
+
+	for i := c.Retries; i > 0; {
+		_, err := conn.WriteTo(next, nextAddr)
+		if err != nil {
+			return nil, err
+		}
+
+		data, from, err := c.readData(conn, tid, block)
+		if err != nil {
+			var netError net.Error
+			// if we timeout then resend the last packet
+			if errors.As(err, &netError) && netError.Timeout() {
+				logger.Debug("timed out waiting for DATA", "block", block)
+				i--
+				continue
+			}
+			return nil, err
+		}
+
+		if tid == nil {
+			tid = from
+		}
+
+		n, err := io.Copy(&file, data.Payload)
+		if err != nil {
+			return nil, err
+		}
+
+		next, err = Ack(data.Block).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		nextAddr = tid
+
+		if n < BlockSize {
+			// final block, ack it and hang around in case the ack is lost
+			_, err = conn.WriteTo(next, tid)
+			if err != nil {
+				return nil, err
+			}
+			c.dally(conn, tid, next, block)
+			logger.Debug("transfer complete", "blocks", block)
+			return file.Bytes(), nil
+		}
+
+		block++
+		i = c.Retries
+	}
+
+	logger.Error("exhausted retries", "block", block)
+	return nil, errors.New("exhausted retries")
+}
+
+// readData waits up to the client timeout for the given block from the
+// server, acknowledging retransmissions of the previous block along the way.
+// Packets from anyone other than tid are rejected, a nil tid accepts the
+// first block from any address.
+func (c Client) readData(conn net.PacketConn, tid net.Addr, block uint16) (Data, net.Addr, error) {
+	var (
+		buf  = make([]byte, DatagramSize)
+		data Data
+		err  Err
+	)
+
+	_ = conn.SetReadDeadline(time.Now().Add(c.Timeout))
+
+	for {
+		n, from, rErr := conn.ReadFrom(buf)
+		if rErr != nil {
+			return Data{}, nil, rErr
+		}
+
+		if tid != nil && from.String() != tid.String() {
+			c.rejectTID(conn, from)
+			continue
+		}
+
+		switch {
+		case data.UnmarshalBinary(buf[:n]) == nil:
+			if data.Block == block {
+				// copy the payload out of buf before it's reused
+				data.Payload = bytes.NewReader(append([]byte(nil), buf[HeaderSize:n]...))
+				return data, from, nil
+			}
+			if tid != nil && data.Block == block-1 {
+				// our ack was lost, send it again
+				ack, _ := Ack(data.Block).MarshalBinary()
+				_, _ = conn.WriteTo(ack, tid)
+			}
+		case err.UnmarshalBinary(buf[:n]) == nil:
+			return Data{}, nil, fmt.Errorf("server error %d: %s", err.Error, err.Message)
+		}
+	}
+}
+
+// dally re-sends the final ack if the server retransmits the final block,
+// until the server goes quiet for a timeout period.
+func (c Client) dally(conn net.PacketConn, tid net.Addr, ack []byte, block uint16) {
+	buf := make([]byte, DatagramSize)
+	var data Data
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(c.Timeout))
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if from.String() == tid.String() && data.UnmarshalBinary(buf[:n]) == nil && data.Block == block {
+			_, _ = conn.WriteTo(ack, tid)
+		}
+	}
+}
+
+// rejectTID tells a stray sender, such as a transfer started by a duplicated
+// read request, that it isn't part of this transfer.
+func (c Client) rejectTID(conn net.PacketConn, addr net.Addr) {
+	pkt, err := Err{Error: ErrUnknown, Message: "unknown transfer ID"}.MarshalBinary()
+	if err != nil {
+		return
+	}
+	_, _ = conn.WriteTo(pkt, addr)
+}
@@ -1,6 +1,6 @@
 module github.com/jm96441n/networkProgrammingInGo/tftp
 
-go 1.19
+go 1.21
 
 require github.com/charmbracelet/log v0.1.1
 
@@ -15,3 +15,7 @@ require (
 	github.com/rivo/uniseg v0.2.0 // indirect
 	golang.org/x/sys v0.0.0-20220811171246-fbc7d0a398ab // indirect
 )
+
+require github.com/jm96441n/networkProgrammingInGo/faultnet v0.0.0
+
+replace github.com/jm96441n/networkProgrammingInGo/faultnet => ../faultnet
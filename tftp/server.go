@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
+	"sync/atomic"
 	"time"
-
-	"github.com/charmbracelet/log"
 )
 
+// sessionID hands out a unique id to each transfer so its log lines can be
+// correlated.
+var sessionID atomic.Uint64
+
 type Server struct {
 	Payload []byte        // payload served for all read request
 	Retries uint8         // number of times to retry a failed  transaction
 	Timeout time.Duration // the duration to wait for an  acknowledgement
+
+	logger *slog.Logger
 }
 
 type option func(*Server)
@@ -26,6 +32,7 @@ func NewServer(payload []byte, opts ...option) (Server, error) {
 		Payload: payload,
 		Retries: 10,
 		Timeout: 6 * time.Second,
+		logger:  slog.Default(),
 	}
 	for _, opt := range opts {
 		opt(&s)
@@ -45,6 +52,21 @@ func WithTimeout(r time.Duration) option {
 	}
 }
 
+// WithLogger sets the logger used by the server, by default this is
+// slog.Default().
+func WithLogger(l *slog.Logger) option {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+func (s Server) log() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
 func (s Server) ListenAndServe(addr string) error {
 	conn, err := net.ListenPacket("udp", addr)
 	if err != nil {
@@ -53,7 +75,7 @@ func (s Server) ListenAndServe(addr string) error {
 
 	defer func() { _ = conn.Close() }()
 
-	log.Info(fmt.Sprintf("Listening on %s...\n", conn.LocalAddr()))
+	s.log().Info("listening", "addr", conn.LocalAddr().String())
 
 	return s.Serve(conn)
 }
@@ -76,7 +98,7 @@ func (s Server) Serve(conn net.PacketConn) error {
 		err = rrq.UnmarshalBinary(buf)
 
 		if err != nil {
-			log.Error(fmt.Sprintf("[%s] bad request: %v", addr, err))
+			s.log().Error("bad request", "remote_addr", addr.String(), "error", err)
 			continue
 		}
 		go s.handle(addr.String(), rrq)
@@ -84,11 +106,12 @@ func (s Server) Serve(conn net.PacketConn) error {
 }
 
 func (s Server) handle(addr string, rrq ReadReq) {
-	log.Info(fmt.Sprintf("[%s] requested file: %s", addr, rrq.Filename))
+	logger := s.log().With("remote_addr", addr, "session_id", sessionID.Add(1))
+	logger.Info("requested file", "filename", rrq.Filename)
 
 	conn, err := net.Dial("udp", addr)
 	if err != nil {
-		log.Error(fmt.Sprintf("[%s] dial: %v", addr, err))
+		logger.Error("dial", "error", err)
 		return
 	}
 
@@ -100,19 +123,19 @@ func (s Server) handle(addr string, rrq ReadReq) {
 
 		data, err := dataPkt.MarshalBinary()
 		if err != nil {
-			log.Error(fmt.Sprintf("[%s] preparing data packet: %v", addr, err))
+			logger.Error("preparing data packet", "block", dataPkt.Block, "error", err)
 			return
 		}
-		n, err = s.writeWithRetry(addr, conn, data, dataPkt.Block)
+		n, err = s.writeWithRetry(logger, conn, data, dataPkt.Block)
 		if err != nil {
 			return
 		}
 
 	}
-	log.Info(fmt.Sprintf("[%s] sent %d blocks", addr, dataPkt.Block))
+	logger.Info("transfer complete", "blocks", dataPkt.Block)
 }
 
-func (s Server) writeWithRetry(addr string, conn net.Conn, data []byte, block uint16) (int, error) {
+func (s Server) writeWithRetry(logger *slog.Logger, conn net.Conn, data []byte, block uint16) (int, error) {
 	var (
 		ackPkt Ack
 		errPkt Err
@@ -121,39 +144,45 @@ func (s Server) writeWithRetry(addr string, conn net.Conn, data []byte, block ui
 	for i := s.Retries; i > 0; i-- {
 		n, err := conn.Write(data) // send the packet
 		if err != nil {
-			log.Error(fmt.Sprintf("[%s] write: %v", addr, err))
+			logger.Error("write", "block", block, "error", err)
 			return 0, err
 		}
 
 		// wait for the client ack
 		_ = conn.SetReadDeadline(time.Now().Add(s.Timeout))
 
-		_, err = conn.Read(buf)
-		if err != nil {
-			var netError net.Error
-			// if we timeout then  retry
-			if errors.As(err, &netError) && netError.Timeout() {
-				continue
+		for {
+			m, err := conn.Read(buf)
+			if err != nil {
+				var netError net.Error
+				// if we timeout then  retry
+				if errors.As(err, &netError) && netError.Timeout() {
+					logger.Debug("timed out waiting for ACK", "block", block)
+					break
+				}
+
+				logger.Error("waiting for ACK", "block", block, "error", err)
+				return 0, err
 			}
 
-			log.Error(fmt.Sprintf("[%s] wating for ACK: %v", addr, err))
-			return 0, err
-		}
-
-		switch {
-		case ackPkt.UnmarshalBinary(buf) == nil:
-			if uint16(ackPkt) == block {
-				// received ack, send next packet
-				return n, nil
+			switch {
+			case ackPkt.UnmarshalBinary(buf[:m]) == nil:
+				if uint16(ackPkt) == block {
+					// received ack, send next packet
+					logger.Debug("received ACK", "block", block)
+					return n, nil
+				}
+				// a duplicated or delayed ACK for an earlier block, resending
+				// here would double the traffic for the rest of the transfer
+				logger.Debug("stale ACK", "block", block, "ack", uint16(ackPkt))
+			case errPkt.UnmarshalBinary(buf[:m]) == nil:
+				logger.Warn("received error", "block", block, "code", errPkt.Error, "message", errPkt.Message)
+				return 0, fmt.Errorf("client error %d: %s", errPkt.Error, errPkt.Message)
+			default:
+				logger.Error("bad packet", "block", block)
 			}
-		case errPkt.UnmarshalBinary(buf) == nil:
-			log.Warn(fmt.Sprintf("[%s] received error: %v", addr, err))
-			return 0, err
-		default:
-			log.Error(fmt.Sprintf("[%s] bad packet", addr))
-
 		}
 	}
-	log.Error(fmt.Sprintf("[%s] exhausted retries", addr))
+	logger.Error("exhausted retries", "block", block)
 	return 0, errors.New("exhausted retries")
 }
@@ -0,0 +1,123 @@
+package tftp_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/faultnet"
+	"github.com/jm96441n/networkProgrammingInGo/tftp"
+)
+
+func TestTransferSurvivesNetworkFaults(t *testing.T) {
+	payload := make([]byte, 20*tftp.BlockSize+100)
+	_, err := rand.Read(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  faultnet.Config
+	}{
+		{name: "clean"},
+		{name: "loss", cfg: faultnet.Config{Seed: 1, Loss: 0.2}},
+		{name: "duplication", cfg: faultnet.Config{Seed: 2, Duplicate: 0.3}},
+		{name: "reordering", cfg: faultnet.Config{Seed: 3, Reorder: 0.3}},
+		{name: "delay", cfg: faultnet.Config{Seed: 4, Delay: 20 * time.Millisecond}},
+		{name: "all", cfg: faultnet.Config{Seed: 5, Loss: 0.1, Duplicate: 0.1, Reorder: 0.1, Delay: 10 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			server, err := tftp.NewServer(payload,
+				tftp.WithRetries(50),
+				tftp.WithTimeout(100*time.Millisecond),
+				tftp.WithLogger(logger),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func() { _ = sConn.Close() }()
+
+			// the server side only sees read requests, the transfer itself
+			// runs over a connection the server dials, so faults on the data
+			// and acks are injected on the client side
+			go func() { _ = server.Serve(faultnet.NewPacketConn(sConn, tt.cfg)) }()
+
+			cConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			faulty := faultnet.NewPacketConn(cConn, tt.cfg)
+			defer func() { _ = faulty.Close() }()
+
+			client := tftp.NewClient(
+				tftp.WithClientRetries(50),
+				tftp.WithClientTimeout(100*time.Millisecond),
+				tftp.WithClientLogger(logger),
+			)
+
+			got, err := client.Get(faulty, sConn.LocalAddr(), "kitten.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, payload) {
+				t.Fatalf("expected %d bytes matching the payload, got %d bytes", len(payload), len(got))
+			}
+			t.Logf("faults injected: %+v", faulty.Stats())
+		})
+	}
+}
+
+func TestTransferOfExactMultipleOfBlockSize(t *testing.T) {
+	payload := bytes.Repeat([]byte{'a'}, 3*tftp.BlockSize)
+
+	server, err := tftp.NewServer(payload,
+		tftp.WithTimeout(100*time.Millisecond),
+		tftp.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sConn.Close() }()
+
+	go func() { _ = server.Serve(sConn) }()
+
+	cConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = cConn.Close() }()
+
+	client := tftp.NewClient(
+		tftp.WithClientTimeout(100*time.Millisecond),
+		tftp.WithClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+
+	got, err := client.Get(cConn, sConn.LocalAddr(), "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("expected %d bytes matching the payload, got %d bytes", len(payload), len(got))
+	}
+}
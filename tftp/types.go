@@ -199,6 +199,10 @@ func (a Ack) MarshalBinary() ([]byte, error) {
 }
 
 func (a *Ack) UnmarshalBinary(p []byte) error {
+	if len(p) != HeaderSize {
+		return errors.New("invalid ACK")
+	}
+
 	var op OpCode
 
 	err := binary.Read(bytes.NewReader(p[:2]), binary.BigEndian, &op)
@@ -251,9 +255,11 @@ func (e Err) MarshalBinary() ([]byte, error) {
 }
 
 func (e *Err) UnmarshalBinary(p []byte) error {
+	r := bytes.NewBuffer(p)
+
 	var code OpCode
 
-	err := binary.Read(bytes.NewReader(p[:2]), binary.BigEndian, &code)
+	err := binary.Read(r, binary.BigEndian, &code)
 	if err != nil {
 		return err
 	}
@@ -262,12 +268,12 @@ func (e *Err) UnmarshalBinary(p []byte) error {
 		return errors.New("invalid Err")
 	}
 
-	err = binary.Read(bytes.NewReader(p[2:4]), binary.BigEndian, &e.Error)
+	err = binary.Read(r, binary.BigEndian, &e.Error)
 	if err != nil {
 		return err
 	}
 
-	err = binary.Read(bytes.NewReader(p[4:]), binary.BigEndian, &e.Message)
+	e.Message, err = r.ReadString(0)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,146 @@
+package tlv_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+var benchPayloads = []struct {
+	name string
+	p    tlv.Payload
+}{
+	{"Int64", ptr(tlv.Int64(1 << 40))},
+	{"Timestamp", ptr(tlv.Timestamp(time.Unix(1700000000, 5)))},
+	{"String", ptr(tlv.String("Clear is better than clever"))},
+	{"Binary1K", ptr(tlv.Binary(bytes.Repeat([]byte{1}, 1<<10)))},
+	{"Binary64K", ptr(tlv.Binary(bytes.Repeat([]byte{1}, 64<<10)))},
+}
+
+func BenchmarkWriteTo(b *testing.B) {
+	for _, bp := range benchPayloads {
+		b.Run(bp.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bp.p.Bytes())))
+			for i := 0; i < b.N; i++ {
+				if _, err := bp.p.WriteTo(io.Discard); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, bp := range benchPayloads {
+		b.Run(bp.name, func(b *testing.B) {
+			enc := tlv.NewEncoder(io.Discard)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(bp.p.Bytes())))
+			for i := 0; i < b.N; i++ {
+				if err := enc.Encode(bp.p); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEncodeChecksum(b *testing.B) {
+	p := ptr(tlv.String("Clear is better than clever"))
+	enc := tlv.NewEncoder(io.Discard, tlv.WithEncoderChecksum())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := enc.Encode(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkWriteToConn measures writing frames to a TCP connection, where
+// header and body go out in one vectored write.
+func BenchmarkWriteToConn(b *testing.B) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer conn.Close()
+
+	p := ptr(tlv.Binary(bytes.Repeat([]byte{1}, 4<<10)))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(p.Bytes())))
+	for i := 0; i < b.N; i++ {
+		if _, err := p.WriteTo(conn); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, bp := range benchPayloads {
+		b.Run(bp.name, func(b *testing.B) {
+			var buf bytes.Buffer
+			if _, err := bp.p.WriteTo(&buf); err != nil {
+				b.Fatal(err)
+			}
+			dec := tlv.NewDecoder(&repeatReader{b: buf.Bytes()})
+
+			b.ReportAllocs()
+			b.SetBytes(int64(buf.Len()))
+			for i := 0; i < b.N; i++ {
+				if _, err := dec.Decode(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// repeatReader reads b over and over.
+type repeatReader struct {
+	b   []byte
+	off int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.b[r.off:])
+	r.off = (r.off + n) % len(r.b)
+	return n, nil
+}
+
+// TestEncodingDoesNotAllocate guards the allocation-free paths the
+// benchmarks measure.
+func TestEncodingDoesNotAllocate(t *testing.T) {
+	enc := tlv.NewEncoder(io.Discard, tlv.WithEncoderChecksum())
+	for _, bp := range benchPayloads {
+		if n := testing.AllocsPerRun(100, func() { _, _ = bp.p.WriteTo(io.Discard) }); n != 0 {
+			t.Errorf("%s: WriteTo made %.0f allocations", bp.name, n)
+		}
+		if n := testing.AllocsPerRun(100, func() { _ = enc.Encode(bp.p) }); n != 0 {
+			t.Errorf("%s: Encode made %.0f allocations", bp.name, n)
+		}
+	}
+
+	// the value receivers shouldn't need their payload moved to the heap
+	s := tlv.String("value")
+	if n := testing.AllocsPerRun(100, func() { _, _ = s.WriteTo(io.Discard) }); n != 0 {
+		t.Errorf("String.WriteTo made %.0f allocations", n)
+	}
+}
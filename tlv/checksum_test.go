@@ -0,0 +1,189 @@
+package tlv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+// checksummed returns each payload encoded as a frame with checksums.
+func checksummed(t *testing.T, payloads ...tlv.Payload) [][]byte {
+	t.Helper()
+
+	frames := make([][]byte, len(payloads))
+	for i, p := range payloads {
+		var buf bytes.Buffer
+		if err := tlv.NewEncoder(&buf, tlv.WithEncoderChecksum()).Encode(p); err != nil {
+			t.Fatal(err)
+		}
+		frames[i] = buf.Bytes()
+	}
+	return frames
+}
+
+func TestChecksumRoundTrip(t *testing.T) {
+	frames := checksummed(t, ptr(tlv.String("one")), ptr(tlv.Int64(2)))
+	if len(frames[0]) != tlv.HeaderSize+2*tlv.ChecksumSize+3 {
+		t.Errorf("expected a %d byte frame, got %d", tlv.HeaderSize+2*tlv.ChecksumSize+3, len(frames[0]))
+	}
+
+	dec := tlv.NewDecoder(bytes.NewReader(bytes.Join(frames, nil)), tlv.WithChecksum())
+	for _, want := range []string{"one", "2"} {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestChecksumRecoversFromCorruptFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int // of the flipped bit in the middle frame
+	}{
+		{"type", 0},
+		{"size", 2},
+		{"header checksum", tlv.HeaderSize},
+		{"body", tlv.HeaderSize + tlv.ChecksumSize + 1},
+		{"body checksum", -1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			frames := checksummed(t,
+				ptr(tlv.String("before")),
+				ptr(tlv.String("corrupt")),
+				ptr(tlv.String("after")),
+			)
+			middle := frames[1]
+			offset := tc.offset
+			if offset < 0 {
+				offset += len(middle)
+			}
+			middle[offset] ^= 0x10
+
+			dec := tlv.NewDecoder(bytes.NewReader(bytes.Join(frames, nil)), tlv.WithChecksum())
+
+			got, err := dec.Decode()
+			if err != nil || got.String() != "before" {
+				t.Fatalf("expected before, got %v, %v", got, err)
+			}
+
+			_, err = dec.Decode()
+			if !errors.Is(err, tlv.ErrChecksum) {
+				t.Fatalf("expected ErrChecksum, got %v", err)
+			}
+
+			got, err = dec.Decode()
+			if err != nil || got.String() != "after" {
+				t.Fatalf("expected to resync on after, got %v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestChecksumSkipsGarbageBetweenFrames(t *testing.T) {
+	frames := checksummed(t, ptr(tlv.String("after the noise")))
+	stream := append([]byte("some noise on the line"), frames[0]...)
+
+	dec := tlv.NewDecoder(bytes.NewReader(stream), tlv.WithChecksum())
+
+	_, err := dec.Decode()
+	if !errors.Is(err, tlv.ErrChecksum) {
+		t.Fatalf("expected ErrChecksum, got %v", err)
+	}
+
+	got, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "after the noise" {
+		t.Errorf("expected after the noise, got %q", got)
+	}
+}
+
+// corruptThenGood returns a frame whose body is corrupt followed by a good
+// one of "found".
+func corruptThenGood(t *testing.T) []byte {
+	t.Helper()
+	frames := checksummed(t, ptr(tlv.String("lost")), ptr(tlv.String("found")))
+	frames[0][tlv.HeaderSize+tlv.ChecksumSize] ^= 0xff
+	return bytes.Join(frames, nil)
+}
+
+func TestServerSkipsCorruptFrames(t *testing.T) {
+	s, err := tlv.NewServer(echo,
+		tlv.WithAddr("127.0.0.1:0"),
+		tlv.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		tlv.WithDecoderOptions(tlv.WithChecksum()),
+		tlv.WithEncoderOptions(tlv.WithEncoderChecksum()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Run() }()
+	defer func() { _ = s.Shutdown(context.Background()) }()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+
+	if _, err := conn.Write(corruptThenGood(t)); err != nil {
+		t.Fatal(err)
+	}
+	p, err := tlv.NewDecoder(conn, tlv.WithChecksum()).Decode()
+	if err != nil {
+		t.Fatalf("expected the connection to survive the corrupt frame, got %v", err)
+	}
+	if p.String() != "found" {
+		t.Errorf("expected found, got %q", p)
+	}
+}
+
+func TestClientSkipsCorruptFrames(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	wire := corruptThenGood(t)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = conn.Write(wire)
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := tlv.NewClient(tlv.WithClientAddr(l.Addr().String()), quiet, tlv.WithClientDecoderOptions(tlv.WithChecksum()))
+	go func() { _ = c.Run(ctx) }()
+
+	select {
+	case p := <-c.Payloads():
+		if p.String() != "found" {
+			t.Errorf("expected found, got %q", p)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the frame after the corrupt one")
+	}
+}
@@ -1,71 +1,359 @@
 package tlv
 
 import (
-	"bytes"
-	"encoding/binary"
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrClientRan is returned by Client.Run when the client has already been run.
+var ErrClientRan = errors.New("tlv: client already run")
+
+// Client keeps a connection to a server, delivering the payloads it receives
+// to a callback or over the channel returned by Payloads.
 type Client struct {
+	network      string
 	addr         string
-	payloadCount int
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	reconnect    bool
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	callback     func(Payload)
+	decoderOpts  []decoderOption
+	encoderOpts  []encoderOption
+	hello        *Hello
+	logger       *slog.Logger
+
+	payloads chan Payload
+	done     chan struct{} // closed when Run returns
+	ran      atomic.Bool
+
+	mu    sync.Mutex
+	conn  net.Conn
+	enc   *Encoder
+	ready chan struct{} // closed while there is a connection
 }
 
+type clientOption func(*Client)
+
+// RunClient sends a few payloads to the server started by RunServer and logs
+// the echoes.
 func RunClient() error {
-	return NewClient().Run()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	c := NewClient()
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(ctx) }()
+
+	b1 := Binary("Clear is better than clever")
+	b2 := Binary("Don't panic")
+	s1 := String("errors are values")
+
+	for _, p := range []Payload{&b1, &b2, &s1} {
+		err := c.Send(ctx, p)
+		if err != nil {
+			cancel()
+			return errors.Join(err, <-errs)
+		}
+
+		actual, ok := <-c.Payloads()
+		if !ok {
+			return <-errs
+		}
+		log.Printf("[%T] %[1]q", actual)
+	}
+
+	cancel()
+	<-errs
+	return nil
 }
 
-func NewClient() Client {
-	return Client{
-		addr:         "127.0.0.1:3000",
-		payloadCount: 3,
+func NewClient(opts ...clientOption) *Client {
+	c := &Client{
+		network:    "tcp",
+		addr:       "127.0.0.1:3000",
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+		logger:     slog.Default(),
+		payloads:   make(chan Payload),
+		done:       make(chan struct{}),
+		ready:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
 }
 
-func (c Client) Run() error {
-	conn, err := net.Dial("tcp", c.addr)
-	if err != nil {
-		return err
+// WithClientNetwork sets the network used to reach the server, by default
+// this is tcp. Over the datagram networks, udp and unixgram, each payload is
+// sent as a datagram of its own and datagrams received are read with a
+// DatagramDecoder, dropping those that don't decode.
+func WithClientNetwork(network string) clientOption {
+	return func(c *Client) {
+		c.network = network
 	}
+}
 
-	defer conn.Close()
+// WithClientAddr sets the address of the server, by default this is
+// 127.0.0.1:3000.
+func WithClientAddr(addr string) clientOption {
+	return func(c *Client) {
+		c.addr = addr
+	}
+}
 
-	for i := 0; i < c.payloadCount; i++ {
-		actual, err := decode(conn)
-		if err != nil {
+// WithReadTimeout sets how long the client waits for each payload before
+// giving up on the connection, by default it waits forever.
+func WithReadTimeout(d time.Duration) clientOption {
+	return func(c *Client) {
+		c.readTimeout = d
+	}
+}
+
+// WithWriteTimeout sets the deadline for writing each payload, by default
+// there is none.
+func WithWriteTimeout(d time.Duration) clientOption {
+	return func(c *Client) {
+		c.writeTimeout = d
+	}
+}
+
+// WithReconnect makes the client redial when it loses its connection, waiting
+// min between attempts and doubling that up to max.
+func WithReconnect(min, max time.Duration) clientOption {
+	return func(c *Client) {
+		c.reconnect = true
+		c.minBackoff, c.maxBackoff = min, max
+	}
+}
+
+// WithCallback passes each payload received to fn instead of sending it on
+// the Payloads channel. fn is called from the goroutine running Run.
+func WithCallback(fn func(Payload)) clientOption {
+	return func(c *Client) {
+		c.callback = fn
+	}
+}
+
+// WithClientDecoderOptions sets the options for the decoder reading from the
+// server.
+func WithClientDecoderOptions(opts ...decoderOption) clientOption {
+	return func(c *Client) {
+		c.decoderOpts = opts
+	}
+}
+
+// WithClientEncoderOptions sets the options for the encoder writing to the
+// server.
+func WithClientEncoderOptions(opts ...encoderOption) clientOption {
+	return func(c *Client) {
+		c.encoderOpts = opts
+	}
+}
+
+// WithClientHandshake makes the client exchange h with the server through
+// Handshake each time it connects, before anything is sent or received. The
+// decoder and encoder for the connection then use what was negotiated, along
+// with the options from WithClientDecoderOptions and WithClientEncoderOptions.
+func WithClientHandshake(h Hello) clientOption {
+	return func(c *Client) {
+		c.hello = &h
+	}
+}
+
+// WithClientLogger sets the logger used by the client, by default this is
+// slog.Default().
+func WithClientLogger(l *slog.Logger) clientOption {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// Payloads returns the channel the payloads received are delivered on, unless
+// a callback was set. It is closed when Run returns.
+func (c *Client) Payloads() <-chan Payload { return c.payloads }
+
+// Run connects to the server and reads payloads until ctx is done, returning
+// ctx.Err(). Without WithReconnect it also returns when the connection is
+// lost, with nil if the server closed it. A client can only be run once,
+// later calls returning ErrClientRan.
+func (c *Client) Run(ctx context.Context) error {
+	if c.ran.Swap(true) {
+		return ErrClientRan
+	}
+	defer close(c.payloads)
+	defer close(c.done)
+
+	if c.hello != nil && isDatagram(c.network) {
+		return errors.New("handshakes need a stream network")
+	}
+
+	backoff := c.minBackoff
+	for {
+		var d net.Dialer
+		if c.network == "unixgram" {
+			// the server can only reply to a socket with a name
+			d.LocalAddr = &net.UnixAddr{Name: tempSocket(), Net: "unixgram"}
+		}
+		conn, err := d.DialContext(ctx, c.network, c.addr)
+		if err == nil {
+			backoff = c.minBackoff
+			err = c.serve(ctx, conn)
+		}
+		if d.LocalAddr != nil {
+			_ = os.Remove(d.LocalAddr.String())
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !c.reconnect {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
 			return err
 		}
-		log.Printf("[%T] %[1]q", actual)
+
+		c.logger.Warn("connection lost, reconnecting", "addr", c.addr, "error", err, "backoff", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, c.maxBackoff)
+	}
+}
+
+// Send writes p to the server, waiting for a connection if there isn't one.
+func (c *Client) Send(ctx context.Context, p Payload) error {
+	for {
+		c.mu.Lock()
+		if c.conn != nil {
+			if c.writeTimeout > 0 {
+				_ = c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+			}
+			err := c.enc.Encode(p)
+			c.mu.Unlock()
+			return err
+		}
+		ready := c.ready
+		c.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-c.done:
+			return ErrClientClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
-	return nil
 }
 
-func decode(r io.Reader) (Payload, error) {
-	var typ uint8
+func (c *Client) serve(ctx context.Context, conn net.Conn) error {
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
 
-	err := binary.Read(r, binary.BigEndian, &typ)
-	if err != nil {
-		return nil, err
+	dec := NewDecoder(conn, c.decoderOpts...)
+	enc := NewEncoder(conn, c.encoderOpts...)
+	decode := dec.Decode
+	if isDatagram(c.network) {
+		enc = NewEncoder(conn, append([]encoderOption{WithDatagrams(MaxDatagramSize)}, c.encoderOpts...)...)
+		decode = c.datagramDecoder(conn.(net.PacketConn))
+	}
+	if c.hello != nil {
+		_ = conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		session, err := Handshake(conn, *c.hello)
+		if err != nil {
+			_ = conn.Close()
+			return err
+		}
+		_ = conn.SetDeadline(time.Time{})
+		decode = session.NewDecoder(conn, c.decoderOpts...).Decode
+		enc = session.NewEncoder(conn, c.encoderOpts...)
 	}
 
-	var payload Payload
+	c.mu.Lock()
+	c.conn, c.enc = conn, enc
+	close(c.ready)
+	c.mu.Unlock()
 
-	switch typ {
-	case BinaryType:
-		payload = new(Binary)
-	case StringType:
-		payload = new(String)
-	default:
-		return nil, errors.New("unknown type")
+	defer func() {
+		// close first so a Send stuck writing lets go of the lock
+		_ = conn.Close()
+		c.mu.Lock()
+		c.conn, c.enc = nil, nil
+		c.ready = make(chan struct{})
+		c.mu.Unlock()
+	}()
 
+	c.logger.Debug("connected", "addr", c.addr)
+
+	for {
+		if c.readTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+		}
+
+		p, err := decode()
+		if err != nil {
+			if errors.Is(err, ErrUnknownType) || errors.Is(err, ErrUnsupportedType) {
+				c.logger.Warn("skipping payload", "error", err)
+				continue
+			}
+			if errors.Is(err, ErrChecksum) {
+				// the decoder finds the next good frame by itself
+				c.logger.Warn("skipping corrupt frame", "error", err)
+				continue
+			}
+			return err
+		}
+
+		if c.callback != nil {
+			c.callback(p)
+			continue
+		}
+
+		select {
+		case c.payloads <- p:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
+}
 
-	_, err = payload.ReadFrom(io.MultiReader(bytes.NewReader([]byte{typ}), r))
-	if err != nil {
-		return nil, err
+// datagramDecoder returns a function decoding the payloads in the datagrams
+// read from conn, which passes over datagrams that don't decode rather than
+// giving up on the connection.
+func (c *Client) datagramDecoder(conn net.PacketConn) func() (Payload, error) {
+	dec := NewDatagramDecoder(conn, c.decoderOpts...)
+	return func() (Payload, error) {
+		for {
+			p, addr, err := dec.Decode()
+			if err != nil && addr != nil && !errors.Is(err, ErrUnknownType) && !errors.Is(err, ErrUnsupportedType) {
+				c.logger.Warn("dropping datagram", "error", err)
+				continue
+			}
+			return p, err
+		}
 	}
-	return payload, nil
+}
+
+var clientSockets atomic.Int64
+
+// tempSocket returns a path for a client's unixgram socket.
+func tempSocket() string {
+	name := fmt.Sprintf("tlv-%d-%d.sock", os.Getpid(), clientSockets.Add(1))
+	return filepath.Join(os.TempDir(), name)
 }
@@ -0,0 +1,158 @@
+package tlv_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+var quiet = tlv.WithClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+func TestClientDeliversPayloadsOverChannel(t *testing.T) {
+	s := newServer(t, echo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := tlv.NewClient(tlv.WithClientAddr(s.Addr().String()), quiet)
+	errs := make(chan error, 1)
+	go func() { errs <- c.Run(ctx) }()
+
+	for _, want := range []string{"one", "two", "three"} {
+		if err := c.Send(ctx, ptr(tlv.String(want))); err != nil {
+			t.Fatal(err)
+		}
+		got := <-c.Payloads()
+		if got.String() != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if _, ok := <-c.Payloads(); ok {
+		t.Error("expected Payloads to be closed once Run returns")
+	}
+	if err := c.Send(context.Background(), ptr(tlv.String("late"))); !errors.Is(err, tlv.ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestClientDeliversPayloadsToCallback(t *testing.T) {
+	s := newServer(t, echo)
+
+	got := make(chan tlv.Payload, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c := tlv.NewClient(tlv.WithClientAddr(s.Addr().String()), quiet,
+		tlv.WithCallback(func(p tlv.Payload) { got <- p }))
+	go func() { _ = c.Run(ctx) }()
+
+	if err := c.Send(ctx, ptr(tlv.Bool(true))); err != nil {
+		t.Fatal(err)
+	}
+	if p := <-got; p.String() != "true" {
+		t.Errorf("expected true, got %s", p)
+	}
+}
+
+func TestClientReadTimeout(t *testing.T) {
+	s := newServer(t, echo)
+
+	c := tlv.NewClient(tlv.WithClientAddr(s.Addr().String()), quiet,
+		tlv.WithReadTimeout(20*time.Millisecond))
+
+	err := c.Run(context.Background())
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected os.ErrDeadlineExceeded, got %v", err)
+	}
+}
+
+func TestClientReconnectsWhenServerDropsConnection(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+
+	// each connection gets a single payload and is then dropped
+	go func() {
+		for i := 0; ; i++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_ = tlv.NewEncoder(conn).Encode(ptr(tlv.Int64(i)))
+			_ = conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := tlv.NewClient(tlv.WithClientAddr(l.Addr().String()), quiet,
+		tlv.WithReconnect(time.Millisecond, 10*time.Millisecond))
+	go func() { _ = c.Run(ctx) }()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case p := <-c.Payloads():
+			if n := *p.(*tlv.Int64); n != tlv.Int64(i) {
+				t.Errorf("expected %d, got %d", i, n)
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for the client to reconnect")
+		}
+	}
+}
+
+func TestClientWithoutReconnectStopsWhenServerCloses(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	c := tlv.NewClient(tlv.WithClientAddr(l.Addr().String()), quiet)
+	if err := c.Run(context.Background()); err != nil {
+		t.Errorf("expected nil when the server closes the connection, got %v", err)
+	}
+}
+
+func TestClientRunsOnlyOnce(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	c := tlv.NewClient(tlv.WithClientAddr(l.Addr().String()), quiet)
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); !errors.Is(err, tlv.ErrClientRan) {
+		t.Errorf("expected ErrClientRan, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func runBuild(args []string) error {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	out := fs.String("o", "", "write the frames to this file instead of stdout")
+	connect := fs.String("connect", "", "send the frames to the server at this address")
+	checksum := fs.Bool("checksum", false, "write frames with checksums")
+	varint := fs.Bool("varint", false, "write frames with varint headers")
+	compress := fs.Int("compress", 0, "gzip bodies of at least this many bytes, 0 never does")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tlv build [-o file | -connect addr] [-checksum] [-varint] [-compress n] [file.json]\n")
+		fmt.Fprintf(fs.Output(), "\nThe input holds JSON frames in the form printed by tlv dump -json, one after\nanother or in arrays.\n\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	in, err := openSource(fs.Arg(0), "", "")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	w, err := openSink(*out, *connect)
+	if err != nil {
+		return err
+	}
+
+	opts := []func(*tlv.Encoder){tlv.WithCompression(*compress)}
+	if *checksum {
+		opts = append(opts, tlv.WithEncoderChecksum())
+	}
+	if *varint {
+		opts = append(opts, tlv.WithEncoderVarintHeader())
+	}
+	enc := tlv.NewEncoder(w, func(e *tlv.Encoder) {
+		for _, opt := range opts {
+			opt(e)
+		}
+	})
+
+	err = buildFrames(in, enc)
+	if cErr := w.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// openSink opens the file named path, or a TCP connection if connect is set,
+// falling back to stdout.
+func openSink(path, connect string) (io.WriteCloser, error) {
+	switch {
+	case connect != "":
+		return net.Dial("tcp", connect)
+	case path != "":
+		return os.Create(path)
+	}
+	return nopWriteCloser{os.Stdout}, nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// buildFrames encodes each of the JSON frames read from r.
+func buildFrames(r io.Reader, enc *tlv.Encoder) error {
+	dec := json.NewDecoder(r)
+	for n := 1; ; {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var frames []*frame
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '[' {
+			err = json.Unmarshal(raw, &frames)
+		} else {
+			frames = make([]*frame, 1)
+			err = json.Unmarshal(raw, &frames[0])
+		}
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", n, err)
+		}
+
+		for _, f := range frames {
+			p, err := fromFrame(f)
+			if err != nil {
+				return fmt.Errorf("frame %d: %w", n, err)
+			}
+			err = enc.Encode(p)
+			if err != nil {
+				return fmt.Errorf("frame %d: %w", n, err)
+			}
+			n++
+		}
+	}
+}
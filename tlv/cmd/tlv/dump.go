@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+// maxHex is the most of a body the text dump shows as hex.
+const maxHex = 32
+
+func runDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print one JSON object per frame instead of text")
+	checksum := fs.Bool("checksum", false, "read frames written with checksums")
+	varint := fs.Bool("varint", false, "read frames written with varint headers")
+	connect := fs.String("connect", "", "dump what the server at this address sends")
+	listen := fs.String("listen", "", "accept a connection on this address and dump what it sends")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tlv dump [-json] [-checksum] [-varint] [-connect addr | -listen addr | file]\n")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	r, err := openSource(fs.Arg(0), *connect, *listen)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	var opts []func(*tlv.Decoder)
+	if *checksum {
+		opts = append(opts, tlv.WithChecksum())
+	}
+	if *varint {
+		opts = append(opts, tlv.WithVarintHeader())
+	}
+	dec := tlv.NewDecoder(r, func(d *tlv.Decoder) {
+		for _, opt := range opts {
+			opt(d)
+		}
+	})
+
+	show := func(f *frame) { printText(os.Stdout, f) }
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		show = func(f *frame) { _ = enc.Encode(f) }
+	}
+
+	// where the frame found after skipping ahead to resync starts isn't known
+	resynced := false
+	for {
+		offset := dec.InputOffset()
+		s, err := dec.DecodeStream()
+		switch {
+		case err == io.EOF:
+			return nil
+		case errors.Is(err, tlv.ErrChecksum):
+			// the decoder finds the next good frame by itself
+			fmt.Fprintf(os.Stderr, "tlv: %s, resynchronizing\n", err)
+			resynced = true
+			continue
+		case err != nil:
+			return err
+		}
+
+		f, err := readFrame(s)
+		if err != nil && !errors.Is(err, tlv.ErrChecksum) {
+			return err
+		}
+		if !resynced {
+			f.Offset = &offset
+		}
+		resynced = false
+		show(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "tlv: %s frame: %s\n", f.Type, err)
+		}
+	}
+}
+
+// openSource opens the file named path, stdin if it's empty or "-", or a TCP
+// connection if either address is set.
+func openSource(path, connect, listen string) (io.ReadCloser, error) {
+	switch {
+	case connect != "":
+		return net.Dial("tcp", connect)
+	case listen != "":
+		l, err := net.Listen("tcp", listen)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = l.Close() }()
+		fmt.Fprintf(os.Stderr, "tlv: waiting for a connection on %s\n", l.Addr())
+		return l.Accept()
+	case path == "" || path == "-":
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+// readFrame reads the body of s and decodes it. Frames too large to decode
+// are described without their body.
+func readFrame(s *tlv.Stream) (*frame, error) {
+	length := int(s.Size)
+	if s.Size > uint64(tlv.MaxPayloadSize) {
+		// read past it so the next frame's offset is known
+		_, err := io.Copy(io.Discard, s.R)
+		return &frame{Type: typeName(s.Typ), Length: &length, Invalid: "too large to decode"}, err
+	}
+
+	body, err := io.ReadAll(s.R)
+	if err != nil {
+		return &frame{Type: typeName(s.Typ), Length: &length, Invalid: err.Error()}, err
+	}
+	return decodeBody(s.Typ, body), nil
+}
+
+// printText writes f as an indented outline, a line for the frame and one for
+// each payload nested inside it.
+func printText(w io.Writer, f *frame) {
+	label := "@? "
+	if f.Offset != nil {
+		label = fmt.Sprintf("@%d ", *f.Offset)
+	}
+	writeText(w, f, "", label)
+}
+
+func writeText(w io.Writer, f *frame, indent, label string) {
+	var line strings.Builder
+	fmt.Fprintf(&line, "%s%s%s len %d", indent, label, f.Type, deref(f.Length))
+
+	switch {
+	case f.Elem != "":
+		fmt.Fprintf(&line, " of %s", f.Elem)
+	case f.Method != "":
+		fmt.Fprintf(&line, " id %d method %s", deref(f.ID), f.Method)
+	case f.ID != nil:
+		fmt.Fprintf(&line, " id %d", *f.ID)
+	case f.Code != nil:
+		fmt.Fprintf(&line, ": %d %q", *f.Code, f.Message)
+	case len(f.Value) > 0:
+		fmt.Fprintf(&line, ": %s", f.Value)
+	case f.Hex != "":
+		h := f.Hex
+		if len(h) > 2*maxHex {
+			h = h[:2*maxHex] + "..."
+		}
+		fmt.Fprintf(&line, ": %s", h)
+	}
+	if f.Invalid != "" {
+		fmt.Fprintf(&line, " (%s)", f.Invalid)
+	}
+	fmt.Fprintln(w, line.String())
+
+	indent += "  "
+	for _, item := range f.Items {
+		writeText(w, item, indent, "")
+	}
+	keys := make([]string, 0, len(f.Entries))
+	for k := range f.Entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeText(w, f.Entries[k], indent, fmt.Sprintf("%q: ", k))
+	}
+	for _, fl := range f.Fields {
+		writeText(w, fl.Value, indent, fmt.Sprintf("%d: ", fl.Tag))
+	}
+	if f.Body != nil {
+		writeText(w, f.Body, indent, "body: ")
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+// frame is the JSON form of a payload, used both for dumps and as the input
+// to build. Only the fields that apply to the type are set, and length,
+// offset and invalid are informational and ignored by build.
+type frame struct {
+	Offset *int64 `json:"offset,omitempty"`
+	Type   string `json:"type"`
+	Length *int   `json:"length,omitempty"`
+
+	Value   json.RawMessage   `json:"value,omitempty"`   // scalars
+	Hex     string            `json:"hex,omitempty"`     // binary and unknown types
+	Elem    string            `json:"elem,omitempty"`    // list
+	Items   []*frame          `json:"items,omitempty"`   // list
+	Entries map[string]*frame `json:"entries,omitempty"` // map
+	Fields  []*field          `json:"fields,omitempty"`  // record
+	ID      *uint64           `json:"id,omitempty"`      // call and reply
+	Method  string            `json:"method,omitempty"`  // call
+	Body    *frame            `json:"body,omitempty"`    // call, reply and compressed
+	Code    *uint16           `json:"code,omitempty"`    // error
+	Message string            `json:"message,omitempty"` // error
+
+	Invalid string `json:"invalid,omitempty"` // why the body couldn't be decoded
+}
+
+type field struct {
+	Tag   uint16 `json:"tag"`
+	Value *frame `json:"value"`
+}
+
+var typeNames = map[uint8]string{
+	tlv.BinaryType:     "binary",
+	tlv.StringType:     "string",
+	tlv.Int8Type:       "int8",
+	tlv.Int16Type:      "int16",
+	tlv.Int32Type:      "int32",
+	tlv.Int64Type:      "int64",
+	tlv.Uint8Type:      "uint8",
+	tlv.Uint16Type:     "uint16",
+	tlv.Uint32Type:     "uint32",
+	tlv.Uint64Type:     "uint64",
+	tlv.VarintType:     "varint",
+	tlv.UvarintType:    "uvarint",
+	tlv.Float64Type:    "float64",
+	tlv.BoolType:       "bool",
+	tlv.TimestampType:  "timestamp",
+	tlv.ListType:       "list",
+	tlv.MapType:        "map",
+	tlv.RecordType:     "record",
+	tlv.CallType:       "call",
+	tlv.ReplyType:      "reply",
+	tlv.ErrorType:      "error",
+	tlv.CompressedType: "compressed",
+	tlv.ExtendedType:   "extended",
+}
+
+// typeName returns the name of typ, or its number for types without one.
+func typeName(typ uint8) string {
+	if name, ok := typeNames[typ]; ok {
+		return name
+	}
+	return strconv.Itoa(int(typ))
+}
+
+// typeCode is the reverse of typeName.
+func typeCode(name string) (uint8, error) {
+	for typ, n := range typeNames {
+		if n == name {
+			return typ, nil
+		}
+	}
+	n, err := strconv.ParseUint(name, 10, 8)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("unknown type %q", name)
+	}
+	return uint8(n), nil
+}
+
+// decodeBody decodes the body of a frame of type typ, falling back to its raw
+// bytes for types that aren't registered or bodies that don't decode.
+func decodeBody(typ uint8, body []byte) *frame {
+	p, err := tlv.DefaultRegistry.New(typ)
+	if err == nil {
+		err = p.UnmarshalBinary(body)
+	}
+	if err != nil {
+		f := toFrame(&tlv.Raw{Typ: typ, Body: body})
+		if !errors.Is(err, tlv.ErrUnknownType) {
+			f.Invalid = err.Error()
+		}
+		return f
+	}
+	return toFrame(p)
+}
+
+func toFrame(p tlv.Payload) *frame {
+	length := len(p.Bytes())
+	f := &frame{Type: typeName(p.Type()), Length: &length}
+
+	switch v := p.(type) {
+	case *tlv.Binary:
+		f.Hex = hex.EncodeToString(*v)
+	case *tlv.String:
+		f.Value = mustMarshal(string(*v))
+	case *tlv.Int8, *tlv.Int16, *tlv.Int32, *tlv.Int64, *tlv.Varint,
+		*tlv.Uint8, *tlv.Uint16, *tlv.Uint32, *tlv.Uint64, *tlv.Uvarint, *tlv.Bool:
+		f.Value = json.RawMessage(v.String())
+	case *tlv.Float64:
+		n := float64(*v)
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			// JSON has no NaN or infinities, so they're written as strings
+			f.Value = mustMarshal(v.String())
+		} else {
+			f.Value = mustMarshal(n)
+		}
+	case *tlv.Timestamp:
+		f.Value = mustMarshal(v.Time().Format(time.RFC3339Nano))
+	case *tlv.List:
+		f.Elem = typeName(v.Elem)
+		for _, item := range v.Items {
+			f.Items = append(f.Items, toFrame(item))
+		}
+	case *tlv.Map:
+		f.Entries = make(map[string]*frame, len(*v))
+		for k, item := range *v {
+			f.Entries[k] = toFrame(item)
+		}
+	case *tlv.Record:
+		for _, fl := range *v {
+			f.Fields = append(f.Fields, &field{Tag: fl.Tag, Value: toFrame(fl.Value)})
+		}
+	case *tlv.Call:
+		f.ID, f.Method = &v.ID, v.Method
+		if v.Body != nil {
+			f.Body = toFrame(v.Body)
+		}
+	case *tlv.Reply:
+		f.ID = &v.ID
+		if v.Body != nil {
+			f.Body = toFrame(v.Body)
+		}
+	case *tlv.Error:
+		f.Code, f.Message = &v.Code, v.Message
+	case *tlv.Compressed:
+		f.Body = toFrame(v.Payload)
+	default:
+		f.Hex = hex.EncodeToString(p.Bytes())
+	}
+	return f
+}
+
+func mustMarshal(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func fromFrame(f *frame) (tlv.Payload, error) {
+	if f == nil {
+		return nil, errors.New("missing frame")
+	}
+	typ, err := typeCode(f.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case tlv.BinaryType:
+		b, err := hex.DecodeString(f.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("binary: %w", err)
+		}
+		p := tlv.Binary(b)
+		return &p, nil
+	case tlv.StringType:
+		var s string
+		err := f.unmarshalValue(&s)
+		p := tlv.String(s)
+		return &p, err
+	case tlv.Int8Type:
+		n, err := f.parseInt(8)
+		p := tlv.Int8(n)
+		return &p, err
+	case tlv.Int16Type:
+		n, err := f.parseInt(16)
+		p := tlv.Int16(n)
+		return &p, err
+	case tlv.Int32Type:
+		n, err := f.parseInt(32)
+		p := tlv.Int32(n)
+		return &p, err
+	case tlv.Int64Type:
+		n, err := f.parseInt(64)
+		p := tlv.Int64(n)
+		return &p, err
+	case tlv.VarintType:
+		n, err := f.parseInt(64)
+		p := tlv.Varint(n)
+		return &p, err
+	case tlv.Uint8Type:
+		n, err := f.parseUint(8)
+		p := tlv.Uint8(n)
+		return &p, err
+	case tlv.Uint16Type:
+		n, err := f.parseUint(16)
+		p := tlv.Uint16(n)
+		return &p, err
+	case tlv.Uint32Type:
+		n, err := f.parseUint(32)
+		p := tlv.Uint32(n)
+		return &p, err
+	case tlv.Uint64Type:
+		n, err := f.parseUint(64)
+		p := tlv.Uint64(n)
+		return &p, err
+	case tlv.UvarintType:
+		n, err := f.parseUint(64)
+		p := tlv.Uvarint(n)
+		return &p, err
+	case tlv.Float64Type:
+		var v any
+		err := f.unmarshalValue(&v)
+		if err != nil {
+			return nil, err
+		}
+		var n float64
+		switch v := v.(type) {
+		case float64:
+			n = v
+		case string:
+			n, err = strconv.ParseFloat(v, 64)
+		default:
+			err = fmt.Errorf("float64: invalid value %s", f.Value)
+		}
+		p := tlv.Float64(n)
+		return &p, err
+	case tlv.BoolType:
+		var b bool
+		err := f.unmarshalValue(&b)
+		p := tlv.Bool(b)
+		return &p, err
+	case tlv.TimestampType:
+		var s string
+		err := f.unmarshalValue(&s)
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		p := tlv.Timestamp(t)
+		return &p, err
+	case tlv.ListType:
+		elem, err := typeCode(f.Elem)
+		if err != nil {
+			return nil, fmt.Errorf("list: %w", err)
+		}
+		items, err := fromFrames(f.Items)
+		if err != nil {
+			return nil, err
+		}
+		return tlv.NewList(elem, items...)
+	case tlv.MapType:
+		m := make(tlv.Map, len(f.Entries))
+		for k, entry := range f.Entries {
+			p, err := fromFrame(entry)
+			if err != nil {
+				return nil, fmt.Errorf("map entry %q: %w", k, err)
+			}
+			m[k] = p
+		}
+		return &m, nil
+	case tlv.RecordType:
+		var rec tlv.Record
+		for _, fl := range f.Fields {
+			p, err := fromFrame(fl.Value)
+			if err != nil {
+				return nil, fmt.Errorf("record field %d: %w", fl.Tag, err)
+			}
+			rec = append(rec, tlv.Field{Tag: fl.Tag, Value: p})
+		}
+		return &rec, nil
+	case tlv.CallType:
+		body, err := optionalFrame(f.Body)
+		return &tlv.Call{ID: deref(f.ID), Method: f.Method, Body: body}, err
+	case tlv.ReplyType:
+		body, err := optionalFrame(f.Body)
+		return &tlv.Reply{ID: deref(f.ID), Body: body}, err
+	case tlv.ErrorType:
+		return &tlv.Error{Code: deref(f.Code), Message: f.Message}, nil
+	case tlv.CompressedType:
+		body, err := fromFrame(f.Body)
+		if err != nil {
+			return nil, fmt.Errorf("compressed: %w", err)
+		}
+		return &tlv.Compressed{Payload: body}, nil
+	}
+
+	b, err := hex.DecodeString(f.Hex)
+	if err != nil {
+		return nil, fmt.Errorf("type %d: %w", typ, err)
+	}
+	return &tlv.Raw{Typ: typ, Body: b}, nil
+}
+
+func fromFrames(frames []*frame) ([]tlv.Payload, error) {
+	payloads := make([]tlv.Payload, len(frames))
+	for i, f := range frames {
+		p, err := fromFrame(f)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		payloads[i] = p
+	}
+	return payloads, nil
+}
+
+func optionalFrame(f *frame) (tlv.Payload, error) {
+	if f == nil {
+		return nil, nil
+	}
+	return fromFrame(f)
+}
+
+func deref[T any](p *T) T {
+	var v T
+	if p != nil {
+		v = *p
+	}
+	return v
+}
+
+func (f *frame) unmarshalValue(v any) error {
+	if len(f.Value) == 0 {
+		return fmt.Errorf("%s: missing value", f.Type)
+	}
+	err := json.Unmarshal(f.Value, v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.Type, err)
+	}
+	return nil
+}
+
+func (f *frame) parseInt(bits int) (int64, error) {
+	if len(f.Value) == 0 {
+		return 0, fmt.Errorf("%s: missing value", f.Type)
+	}
+	n, err := strconv.ParseInt(string(f.Value), 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", f.Type, err)
+	}
+	return n, nil
+}
+
+func (f *frame) parseUint(bits int) (uint64, error) {
+	if len(f.Value) == 0 {
+		return 0, fmt.Errorf("%s: missing value", f.Type)
+	}
+	n, err := strconv.ParseUint(string(f.Value), 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", f.Type, err)
+	}
+	return n, nil
+}
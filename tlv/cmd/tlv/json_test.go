@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func TestFramesRoundTripThroughJSON(t *testing.T) {
+	s := tlv.String("gopher")
+	u := tlv.Uint64(math.MaxUint64)
+	n := tlv.Varint(-42)
+	nan := tlv.Float64(math.NaN())
+	ts := tlv.Timestamp(time.Date(2009, 11, 10, 23, 0, 0, 5, time.UTC))
+	b := tlv.Binary{0xde, 0xad}
+	ports, _ := tlv.NewList(tlv.Uint16Type)
+	rec := tlv.Record{{Tag: 1, Value: &s}, {Tag: 2, Value: ports}}
+	m := tlv.Map{"n": &n}
+
+	payloads := []tlv.Payload{
+		&s, &u, &n, &nan, &ts, &b, &rec, &m,
+		&tlv.Call{ID: 1, Method: "get", Body: &s},
+		&tlv.Reply{ID: 1},
+		&tlv.Error{Code: 2, Message: "nope"},
+		&tlv.Compressed{Payload: &s},
+		&tlv.Raw{Typ: 200, Body: []byte("future")},
+	}
+
+	for _, want := range payloads {
+		data, err := json.Marshal(toFrame(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var f frame
+		if err := json.Unmarshal(data, &f); err != nil {
+			t.Fatal(err)
+		}
+		got, err := fromFrame(&f)
+		if err != nil {
+			t.Fatalf("%s: %v", data, err)
+		}
+
+		if got.Type() != want.Type() || !bytes.Equal(got.Bytes(), want.Bytes()) {
+			if _, ok := want.(*tlv.Compressed); !ok { // gzip output may differ
+				t.Errorf("%s: expected %s, got %s", data, want, got)
+			}
+		}
+	}
+}
+
+func TestBuildFramesAcceptsArraysAndSequences(t *testing.T) {
+	in := `{"type":"string","value":"one"}
+[{"type":"bool","value":true}, {"type":"int8","value":-1}]`
+
+	var buf bytes.Buffer
+	if err := buildFrames(strings.NewReader(in), tlv.NewEncoder(&buf)); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := tlv.NewDecoder(&buf)
+	for _, want := range []string{"one", "true", "-1"} {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestBuildFramesReportsBadFrames(t *testing.T) {
+	tests := []string{
+		`{"type":"uint8","value":300}`,
+		`{"type":"nonsense"}`,
+		`{"type":"list","elem":"string","items":[{"type":"bool","value":true}]}`,
+		`{"type":"string"}`,
+	}
+	for _, in := range tests {
+		err := buildFrames(strings.NewReader(in), tlv.NewEncoder(&bytes.Buffer{}))
+		if err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+}
@@ -8,11 +8,31 @@ import (
 	"github.com/jm96441n/networkProgrammingInGo/tlv"
 )
 
+var subcommands = map[string]func(args []string) error{
+	"dump":  runDump,
+	"build": runBuild,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			err := run(os.Args[2:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "tlv %s: %s\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+	}
+
 	var clientMode bool
 	var serverMode bool
 	flag.BoolVar(&clientMode, "c", false, "run in client mode")
 	flag.BoolVar(&serverMode, "s", false, "run in server mode")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tlv [-c | -s]\n       tlv dump [flags] [source]\n       tlv build [flags] [file.json]\n\n")
+		flag.PrintDefaults()
+	}
 
 	flag.Parse()
 	if clientMode {
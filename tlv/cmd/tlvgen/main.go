@@ -0,0 +1,422 @@
+// Command tlvgen generates tlv.Payload implementations for Go structs, so they
+// can be sent without the reflection tlv.Marshal uses.
+//
+// The structs act as the schema. Each one to generate for is marked with a
+// tlv:type comment giving its frame type, and its fields are tagged with
+// their Record tags the same way as for tlv.Marshal:
+//
+//	//tlv:type 64
+//	type Service struct {
+//		Name   string    `tlv:"1"`
+//		Ports  []uint16  `tlv:"2"`
+//		Owner  *Owner    `tlv:"3"`
+//		Uptime time.Time `tlv:"4"`
+//	}
+//
+// Fields can be bools, integers, floats, strings, []byte, time.Time, other
+// marked structs or pointers to them, and slices of any of these. The
+// payloads are encoded like Records, with fields holding marked structs
+// encoded under those structs' frame types. The generated code registers
+// each type with tlv.DefaultRegistry.
+//
+// tlvgen is meant to be run by go generate, from a directive in the schema
+// file:
+//
+//	//go:generate go run github.com/jm96441n/networkProgrammingInGo/tlv/cmd/tlvgen
+//
+// For a schema file x.go it writes x_tlv.go, or the file named by -o.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func main() {
+	var out string
+	flag.StringVar(&out, "o", "", "output file, by default the input file with a _tlv.go suffix")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: tlvgen [-o output] [file.go]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	in := flag.Arg(0)
+	if in == "" {
+		in = os.Getenv("GOFILE")
+	}
+	if in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if out == "" {
+		out = strings.TrimSuffix(in, ".go") + "_tlv.go"
+	}
+
+	src, err := generate(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tlvgen: %s\n", err)
+		os.Exit(1)
+	}
+
+	err = os.WriteFile(out, src, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tlvgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// record is a struct marked with a tlv:type comment.
+type record struct {
+	name   string
+	typ    uint8
+	fields []field
+	spec   *ast.StructType
+}
+
+type field struct {
+	name string
+	tag  uint16
+	kind kind
+}
+
+// kind is what a field holds, a scalar, a record or a slice of either.
+type kind struct {
+	scalar *scalar
+	record *record
+	ptr    bool  // a pointer to record
+	elem   *kind // set for slices
+}
+
+// scalar describes how a Go type maps to a payload.
+type scalar struct {
+	payload string // name of the payload type in package tlv
+	to      string // converts the Go value %s to the payload
+	from    string // converts the payload %s back to the Go value
+}
+
+var scalars = map[string]*scalar{
+	"bool":      {"Bool", "tlv.Bool(%s)", "bool(%s)"},
+	"int8":      {"Int8", "tlv.Int8(%s)", "int8(%s)"},
+	"int16":     {"Int16", "tlv.Int16(%s)", "int16(%s)"},
+	"int32":     {"Int32", "tlv.Int32(%s)", "int32(%s)"},
+	"int64":     {"Int64", "tlv.Int64(%s)", "int64(%s)"},
+	"int":       {"Varint", "tlv.Varint(%s)", "int(%s)"},
+	"uint8":     {"Uint8", "tlv.Uint8(%s)", "uint8(%s)"},
+	"uint16":    {"Uint16", "tlv.Uint16(%s)", "uint16(%s)"},
+	"uint32":    {"Uint32", "tlv.Uint32(%s)", "uint32(%s)"},
+	"uint64":    {"Uint64", "tlv.Uint64(%s)", "uint64(%s)"},
+	"uint":      {"Uvarint", "tlv.Uvarint(%s)", "uint(%s)"},
+	"float32":   {"Float64", "tlv.Float64(%s)", "float32(%s)"},
+	"float64":   {"Float64", "tlv.Float64(%s)", "float64(%s)"},
+	"string":    {"String", "tlv.String(%s)", "string(%s)"},
+	"[]byte":    {"Binary", "tlv.Binary(%s)", "[]byte(%s)"},
+	"time.Time": {"Timestamp", "tlv.Timestamp(%s)", "%s.Time()"},
+}
+
+// generate returns the formatted source of the payloads for the records in
+// the file named in.
+func generate(in string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, in, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := findRecords(fset, f)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%s: no structs marked with a tlv:type comment", in)
+	}
+
+	byName := make(map[string]*record, len(records))
+	for _, r := range records {
+		byName[r.name] = r
+	}
+	for _, r := range records {
+		err := r.resolveFields(fset, byName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	g := &generator{}
+	g.printf("// Code generated by tlvgen from %s; DO NOT EDIT.\n\n", filepath.Base(in))
+	g.printf("package %s\n\n", f.Name.Name)
+	g.printf("import (\n\"fmt\"\n\"io\"\n\n\"github.com/jm96441n/networkProgrammingInGo/tlv\"\n)\n\n")
+
+	g.printf("func init() {\n")
+	for _, r := range records {
+		g.printf("if err := tlv.Register(%d, func() tlv.Payload { return new(%s) }); err != nil {\npanic(err)\n}\n", r.typ, r.name)
+	}
+	g.printf("}\n")
+
+	for _, r := range records {
+		g.record(r)
+	}
+
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// findRecords returns the structs in f marked with a tlv:type comment.
+func findRecords(fset *token.FileSet, f *ast.File) ([]*record, error) {
+	var records []*record
+	seen := make(map[uint8]string)
+
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			typ, ok, err := typeDirective(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", fset.Position(ts.Pos()), ts.Name.Name, err)
+			}
+			if !ok {
+				continue
+			}
+
+			st, isStruct := ts.Type.(*ast.StructType)
+			if !isStruct || ts.TypeParams != nil {
+				return nil, fmt.Errorf("%s: %s: only non-generic structs can be marked with tlv:type", fset.Position(ts.Pos()), ts.Name.Name)
+			}
+			if other, dup := seen[typ]; dup {
+				return nil, fmt.Errorf("%s: %s and %s have the same type %d", fset.Position(ts.Pos()), other, ts.Name.Name, typ)
+			}
+			seen[typ] = ts.Name.Name
+
+			records = append(records, &record{name: ts.Name.Name, typ: typ, spec: st})
+		}
+	}
+	return records, nil
+}
+
+// typeDirective returns the type given by a tlv:type comment in doc.
+func typeDirective(doc *ast.CommentGroup) (uint8, bool, error) {
+	if doc == nil {
+		return 0, false, nil
+	}
+	for _, c := range doc.List {
+		arg, ok := strings.CutPrefix(c.Text, "//tlv:type ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(arg), 10, 8)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid tlv:type %q", arg)
+		}
+		if uint8(n) < tlv.MinUserType {
+			return 0, false, fmt.Errorf("tlv:type %d is reserved, use %d or above", n, tlv.MinUserType)
+		}
+		return uint8(n), true, nil
+	}
+	return 0, false, nil
+}
+
+// resolveFields works out the tagged fields of r, which may hold any of the
+// records in byName.
+func (r *record) resolveFields(fset *token.FileSet, byName map[string]*record) error {
+	seen := make(map[uint16]string)
+
+	for _, f := range r.spec.Fields.List {
+		if f.Tag == nil {
+			continue
+		}
+		raw, err := strconv.Unquote(f.Tag.Value)
+		if err != nil {
+			return err
+		}
+		tag, ok := reflect.StructTag(raw).Lookup("tlv")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		n, err := strconv.ParseUint(tag, 10, 16)
+		if err != nil {
+			return fmt.Errorf("%s: invalid tag %q on %s", fset.Position(f.Pos()), tag, r.name)
+		}
+
+		k, err := resolveKind(f.Type, byName)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fset.Position(f.Type.Pos()), err)
+		}
+
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			if other, dup := seen[uint16(n)]; dup {
+				return fmt.Errorf("%s: fields %s and %s of %s have the same tag %d", fset.Position(name.Pos()), other, name.Name, r.name, n)
+			}
+			seen[uint16(n)] = name.Name
+
+			r.fields = append(r.fields, field{name: name.Name, tag: uint16(n), kind: k})
+		}
+	}
+	return nil
+}
+
+func resolveKind(expr ast.Expr, byName map[string]*record) (kind, error) {
+	name := types.ExprString(expr)
+	if s, ok := scalars[name]; ok {
+		return kind{scalar: s}, nil
+	}
+	if r, ok := byName[name]; ok {
+		return kind{record: r}, nil
+	}
+	if r, ok := byName[strings.TrimPrefix(name, "*")]; ok && strings.HasPrefix(name, "*") {
+		return kind{record: r, ptr: true}, nil
+	}
+
+	if arr, ok := expr.(*ast.ArrayType); ok && arr.Len == nil {
+		elem, err := resolveKind(arr.Elt, byName)
+		if err != nil {
+			return kind{}, err
+		}
+		if elem.elem != nil || elem.ptr {
+			return kind{}, fmt.Errorf("unsupported slice type %s", name)
+		}
+		return kind{elem: &elem}, nil
+	}
+
+	return kind{}, fmt.Errorf("unsupported type %s", name)
+}
+
+// code returns the expression for the type code of values of kind k.
+func (k kind) code() string {
+	switch {
+	case k.scalar != nil:
+		return "tlv." + k.scalar.payload + "Type"
+	case k.record != nil:
+		return strconv.Itoa(int(k.record.typ))
+	}
+	return "tlv.ListType"
+}
+
+type generator struct {
+	buf bytes.Buffer
+}
+
+func (g *generator) printf(format string, args ...any) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) record(r *record) {
+	g.printf("\nfunc (m *%s) Type() uint8 { return %d }\n", r.name, r.typ)
+	g.printf("func (m *%s) String() string { return fmt.Sprintf(\"%%+v\", *m) }\n\n", r.name)
+	g.printf("func (m *%s) WriteTo(w io.Writer) (int64, error) { return tlv.WriteFrame(w, m) }\n", r.name)
+	g.printf("func (m *%s) ReadFrom(r io.Reader) (int64, error) { return tlv.ReadFrame(r, m) }\n\n", r.name)
+
+	g.printf("func (m *%s) Bytes() []byte {\nvar b []byte\n", r.name)
+	for _, f := range r.fields {
+		g.encodeField(f)
+	}
+	g.printf("return b\n}\n\n")
+
+	g.printf("func (m *%s) UnmarshalBinary(data []byte) error { return m.unmarshalTLV(data, 1) }\n\n", r.name)
+
+	g.printf("func (m *%s) unmarshalTLV(data []byte, depth int) error {\n", r.name)
+	g.printf("if depth > tlv.MaxDepth {\nreturn tlv.ErrMaxDepth\n}\n\n")
+	g.printf("*m = %s{}\n", r.name)
+	g.printf("for len(data) > 0 {\n")
+	g.printf("tag, typ, body, rest, err := tlv.NextField(data)\nif err != nil {\nreturn err\n}\ndata = rest\n\n")
+	g.printf("switch tag {\n")
+	for _, f := range r.fields {
+		g.printf("case %d:\n", f.tag)
+		g.decodeField(r, f)
+	}
+	g.printf("}\n}\nreturn nil\n}\n")
+}
+
+func (g *generator) encodeField(f field) {
+	v := "m." + f.name
+	k := f.kind
+
+	switch {
+	case k.scalar != nil:
+		g.printf("{\np := %s\nb = tlv.AppendField(b, %d, &p)\n}\n", fmt.Sprintf(k.scalar.to, v), f.tag)
+	case k.ptr:
+		g.printf("if %s != nil {\nb = tlv.AppendField(b, %d, %[1]s)\n}\n", v, f.tag)
+	case k.record != nil:
+		g.printf("b = tlv.AppendField(b, %d, &%s)\n", f.tag, v)
+	default:
+		g.printf("{\nl := tlv.List{Elem: %s, Items: make([]tlv.Payload, len(%s))}\n", k.elem.code(), v)
+		if k.elem.scalar != nil {
+			g.printf("for i, v := range %s {\np := %s\nl.Items[i] = &p\n}\n", v, fmt.Sprintf(k.elem.scalar.to, "v"))
+		} else {
+			g.printf("for i := range %s {\nl.Items[i] = &%[1]s[i]\n}\n", v)
+		}
+		g.printf("b = tlv.AppendField(b, %d, &l)\n}\n", f.tag)
+	}
+}
+
+func (g *generator) decodeField(r *record, f field) {
+	v := "m." + f.name
+	k := f.kind
+	path := r.name + "." + f.name
+
+	g.checkType(path, "typ", k.code())
+
+	switch {
+	case k.scalar != nil:
+		g.decodeScalar(k.scalar, "body", v+" = %s")
+	case k.ptr:
+		g.printf("%s = new(%s)\nif err := %[1]s.unmarshalTLV(body, depth+1); err != nil {\nreturn err\n}\n", v, k.record.name)
+	case k.record != nil:
+		g.printf("if err := %s.unmarshalTLV(body, depth+1); err != nil {\nreturn err\n}\n", v)
+	default:
+		elem := k.elem.code()
+		g.printf("if len(body) < 1 || body[0] != %s {\n", elem)
+		g.printf("return fmt.Errorf(\"%%w: %s must be a List of type %%d\", tlv.ErrInvalidPayload, %s)\n}\n", path, elem)
+		g.printf("for body = body[1:]; len(body) > 0; {\n")
+		g.printf("typ, item, rest, err := tlv.NextFrame(body)\nif err != nil {\nreturn err\n}\nbody = rest\n\n")
+		g.checkType(path, "typ", elem)
+		if k.elem.scalar != nil {
+			g.decodeScalar(k.elem.scalar, "item", v+" = append("+v+", %s)")
+		} else {
+			g.printf("var v %s\nif err := v.unmarshalTLV(item, depth+1); err != nil {\nreturn err\n}\n", k.elem.record.name)
+			g.printf("%s = append(%[1]s, v)\n", v)
+		}
+		g.printf("}\n")
+	}
+}
+
+// checkType emits a check that the type code in typ is want.
+func (g *generator) checkType(path, typ, want string) {
+	g.printf("if %s != %s {\n", typ, want)
+	g.printf("return fmt.Errorf(\"%%w: %s has type %%d, want %%d\", tlv.ErrInvalidPayload, %s, %s)\n}\n", path, typ, want)
+}
+
+// decodeScalar emits the decoding of the payload in body, storing the Go
+// value with the statement assign.
+func (g *generator) decodeScalar(s *scalar, body, assign string) {
+	g.printf("var p tlv.%s\nif err := p.UnmarshalBinary(%s); err != nil {\nreturn err\n}\n", s.payload, body)
+	g.printf(assign+"\n", fmt.Sprintf(s.from, "p"))
+}
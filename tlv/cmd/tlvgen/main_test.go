@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedExampleIsUpToDate(t *testing.T) {
+	want, err := os.ReadFile("../../internal/example/schema_tlv.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := generate("../../internal/example/schema.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("internal/example/schema_tlv.go is stale, run go generate")
+	}
+}
+
+func TestGenerateRejectsBadSchemas(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		err    string
+	}{
+		{
+			"reserved type",
+			"//tlv:type 12\ntype A struct{}",
+			"reserved",
+		},
+		{
+			"duplicate type",
+			"//tlv:type 64\ntype A struct{}\n\n//tlv:type 64\ntype B struct{}",
+			"same type",
+		},
+		{
+			"duplicate tag",
+			"//tlv:type 64\ntype A struct {\n\tX int `tlv:\"1\"`\n\tY int `tlv:\"1\"`\n}",
+			"same tag",
+		},
+		{
+			"unsupported field",
+			"//tlv:type 64\ntype A struct {\n\tX map[string]int `tlv:\"1\"`\n}",
+			"unsupported type map[string]int",
+		},
+		{
+			"unmarked field struct",
+			"type B struct{}\n\n//tlv:type 64\ntype A struct {\n\tX B `tlv:\"1\"`\n}",
+			"unsupported type B",
+		},
+		{
+			"nothing marked",
+			"type A struct{}",
+			"no structs marked",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			in := filepath.Join(t.TempDir(), "schema.go")
+			err := os.WriteFile(in, []byte("package schema\n\n"+tc.schema+"\n"), 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = generate(in)
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expected an error containing %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package tlv_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+// countingWriter counts the calls to Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestEncoderWritesEachFrameInOnePiece(t *testing.T) {
+	var w countingWriter
+	enc := tlv.NewEncoder(&w)
+
+	b := tlv.Binary("Clear is better than clever")
+	s := tlv.String("errors are values")
+
+	for _, p := range []tlv.Payload{&b, &s} {
+		err := enc.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if w.writes != 2 {
+		t.Errorf("expected 2 writes, got %d", w.writes)
+	}
+	if want := encode(t, &b, &s); !bytes.Equal(w.Bytes(), want) {
+		t.Errorf("expected %v, got %v", want, w.Bytes())
+	}
+}
+
+func TestEncoderDecoderRoundTrip(t *testing.T) {
+	b1 := tlv.Binary("Clear is better than clever")
+	b2 := tlv.Binary("Don't panic")
+	s1 := tlv.String("errors are values")
+	empty := tlv.String("")
+	payloads := []tlv.Payload{&b1, &b2, &s1, &empty}
+
+	server, client := net.Pipe()
+
+	go func() {
+		defer func() { _ = server.Close() }()
+		enc := tlv.NewEncoder(server)
+		for _, p := range payloads {
+			if err := enc.Encode(p); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	dec := tlv.NewDecoder(iotest.OneByteReader(client))
+	for i, want := range payloads {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Type() != want.Type() || !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("payload %d: expected %T %q, got %T %q", i, want, want, got, got)
+		}
+	}
+
+	_, err := dec.Decode()
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecoderReportsTruncatedFrames(t *testing.T) {
+	s := tlv.String("errors are values")
+	encoded := encode(t, &s)
+
+	_, err := tlv.NewDecoder(bytes.NewReader(encoded[:len(encoded)-1])).Decode()
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestDecoderEnforcesMaxPayloadSize(t *testing.T) {
+	small := tlv.String("small")
+	large := tlv.String("this one is too large")
+
+	dec := tlv.NewDecoder(bytes.NewReader(encode(t, &small, &large)), tlv.WithMaxPayloadSize(10))
+
+	_, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dec.Decode()
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize, got %v", err)
+	}
+}
+
+func TestDecoderEnforcesMaxTotalSize(t *testing.T) {
+	s := tlv.String("0123456789")
+	frame := len(encode(t, &s))
+
+	dec := tlv.NewDecoder(bytes.NewReader(encode(t, &s, &s, &s)), tlv.WithMaxTotalSize(int64(2*frame)))
+
+	for i := 0; i < 2; i++ {
+		_, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := dec.Decode()
+	if !errors.Is(err, tlv.ErrMaxTotalSize) {
+		t.Errorf("expected ErrMaxTotalSize, got %v", err)
+	}
+}
+
+func TestDecoderDoesNotAllocateDeclaredSizeUpFront(t *testing.T) {
+	// a header claiming the largest allowed body, followed by very little
+	header := []byte{tlv.BinaryType, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], tlv.MaxPayloadSize)
+	stream := append(header, "not nearly enough"...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	_, err := tlv.NewDecoder(bytes.NewReader(stream)).Decode()
+
+	runtime.ReadMemStats(&after)
+
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected less than 1MB to be allocated, got %d bytes", allocated)
+	}
+}
+
+func TestDecoderSkipsUnknownTypes(t *testing.T) {
+	unknown := tlv.Raw{Typ: 250, Body: []byte("skip me")}
+	s := tlv.String("next")
+
+	dec := tlv.NewDecoder(bytes.NewReader(encode(t, &unknown, &s)))
+
+	_, err := dec.Decode()
+	if !errors.Is(err, tlv.ErrUnknownType) {
+		t.Fatalf("expected ErrUnknownType, got %v", err)
+	}
+
+	got, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "next" {
+		t.Errorf("expected next, got %s", got)
+	}
+}
@@ -0,0 +1,485 @@
+package tlv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// The elements of Lists, Maps and Records are encoded as complete frames
+// inside the body of the container, so anything that can be sent on its own
+// can be nested. Nested frames are decoded with the registry and held to the
+// types of the Decoder that read the outer one, or with the DefaultRegistry
+// by UnmarshalBinary.
+
+// container is implemented by payloads holding other payloads, so decoding can
+// keep track of how deeply they nest.
+type container interface {
+	unmarshalAt(data []byte, n nesting) error
+}
+
+// nesting is what nested frames are decoded with.
+type nesting struct {
+	depth    int       // how many containers deep the frame is
+	registry *Registry // looks up the type of each frame
+	types    *TypeSet  // the types accepted, nil accepts all of them
+	inflate  *int64    // what Compressed payloads may still inflate to, shared by all of them
+}
+
+// newNesting returns the nesting of a frame decoded with registry and types,
+// whose Compressed payloads may inflate to max bytes between them.
+func newNesting(registry *Registry, types *TypeSet, max uint32) nesting {
+	inflate := int64(max)
+	return nesting{depth: 1, registry: registry, types: types, inflate: &inflate}
+}
+
+// topLevel is the nesting of a payload decoded on its own by UnmarshalBinary.
+func topLevel() nesting { return newNesting(DefaultRegistry, nil, MaxPayloadSize) }
+
+// inside returns the nesting of the frames inside a container at nest.
+func (nest nesting) inside() nesting {
+	nest.depth++
+	return nest
+}
+
+// new returns the payload for a frame of type typ.
+func (nest nesting) new(typ uint8) (Payload, error) {
+	if nest.types != nil && !nest.types.Has(typ) {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedType, typ)
+	}
+	return nest.registry.New(typ)
+}
+
+// decompress inflates the body of a Compressed frame, charging what it
+// inflates to against what's left for the frame it's part of.
+func (nest nesting) decompress(data []byte) (uint8, []byte, error) {
+	typ, body, err := decompress(data, uint32(max(*nest.inflate, 0)))
+	if err != nil {
+		return 0, nil, err
+	}
+	*nest.inflate -= int64(len(body))
+	return typ, body, nil
+}
+
+// unmarshalAt sets p from data, where p is nested as nest describes.
+func unmarshalAt(p Payload, data []byte, nest nesting) error {
+	c, ok := p.(container)
+	if !ok {
+		return p.UnmarshalBinary(data)
+	}
+	if nest.depth > MaxDepth {
+		return ErrMaxDepth
+	}
+	return c.unmarshalAt(data, nest)
+}
+
+// validator is implemented by payloads that can hold values their Bytes
+// can't encode in a form the decoder accepts, such as a Compressed holding
+// another, so encoding can refuse them up front.
+type validator interface {
+	validate() error
+}
+
+// validate checks p and anything nested in it can be encoded.
+func validate(p Payload) error {
+	if v, ok := p.(validator); ok {
+		return v.validate()
+	}
+	return nil
+}
+
+// validateAll validates each of ps that isn't nil.
+func validateAll(ps ...Payload) error {
+	for _, p := range ps {
+		if p == nil {
+			continue
+		}
+		err := validate(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AppendFrame appends p to b as a complete frame, as used for the items of
+// containers. It panics with an error wrapping ErrMaxPayloadSize if the body
+// of p is too large for the 4 byte size in the header; Encoder and WriteFrame
+// return that error instead.
+func AppendFrame(b []byte, p Payload) []byte {
+	body := p.Bytes()
+	if uint64(len(body)) > math.MaxUint32 {
+		panic(itemTooLarge(len(body)))
+	}
+	b = append(b, p.Type())
+	b = binary.BigEndian.AppendUint32(b, uint32(len(body)))
+	return append(b, body...)
+}
+
+// itemTooLarge is the panic value of AppendFrame for a body it can't frame.
+type itemTooLarge int
+
+func (e itemTooLarge) Error() string {
+	return fmt.Sprintf("%v: a %d byte item", ErrMaxPayloadSize, int(e))
+}
+
+func (e itemTooLarge) Unwrap() error { return ErrMaxPayloadSize }
+
+// bodyOf returns p.Bytes, turning a panic from AppendFrame for an item too
+// large to frame into an error.
+func bodyOf(p Payload) (body []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(itemTooLarge)
+			if !ok {
+				panic(r)
+			}
+			err = e
+		}
+	}()
+	return p.Bytes(), nil
+}
+
+// NextFrame splits the first frame off of data, returning its type, its body
+// and what follows it. Truncated frames return ErrInvalidPayload.
+func NextFrame(data []byte) (uint8, []byte, []byte, error) {
+	if len(data) < HeaderSize {
+		return 0, nil, nil, fmt.Errorf("%w: truncated frame header", ErrInvalidPayload)
+	}
+	typ := data[0]
+	sz := binary.BigEndian.Uint32(data[1:])
+	data = data[HeaderSize:]
+	if uint64(sz) > uint64(len(data)) {
+		return 0, nil, nil, fmt.Errorf("%w: truncated frame body", ErrInvalidPayload)
+	}
+	return typ, data[:sz], data[sz:], nil
+}
+
+// decodeFrame splits the first frame off of data and decodes it, returning the
+// payload and what follows it.
+func decodeFrame(data []byte, nest nesting) (Payload, []byte, error) {
+	typ, body, rest, err := NextFrame(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := nest.new(typ)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = unmarshalAt(p, body, nest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, rest, nil
+}
+
+// List is a sequence of payloads that all have the type Elem. It is encoded
+// as the element type followed by a frame for each item. Nil items, which
+// Append refuses, are left out.
+type List struct {
+	Elem  uint8
+	Items []Payload
+}
+
+var (
+	errListElem = errors.New("list item has the wrong type")
+	errListNil  = errors.New("list item is nil")
+)
+
+// NewList returns a List of items of the type elem.
+func NewList(elem uint8, items ...Payload) (*List, error) {
+	l := &List{Elem: elem}
+	for _, item := range items {
+		err := l.Append(item)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Append adds p to the end of the list, p must have the list's element type.
+func (m *List) Append(p Payload) error {
+	if p == nil {
+		return errListNil
+	}
+	if p.Type() != m.Elem {
+		return fmt.Errorf("%w: expected %d, got %d", errListElem, m.Elem, p.Type())
+	}
+	m.Items = append(m.Items, p)
+	return nil
+}
+
+func (m *List) Bytes() []byte {
+	b := []byte{m.Elem}
+	for _, item := range m.Items {
+		if item != nil {
+			b = AppendFrame(b, item)
+		}
+	}
+	return b
+}
+
+func (m *List) String() string {
+	items := make([]string, 0, len(m.Items))
+	for _, item := range m.Items {
+		if item != nil {
+			items = append(items, item.String())
+		}
+	}
+	return "[" + strings.Join(items, " ") + "]"
+}
+
+func (m *List) Type() uint8 { return ListType }
+
+func (m *List) validate() error { return validateAll(m.Items...) }
+
+func (m *List) WriteTo(w io.Writer) (int64, error)  { return WriteFrame(w, m) }
+func (m *List) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *List) UnmarshalBinary(data []byte) error { return m.unmarshalAt(data, topLevel()) }
+
+func (m *List) unmarshalAt(data []byte, nest nesting) error {
+	if len(data) < 1 {
+		return fmt.Errorf("%w: List is missing its element type", ErrInvalidPayload)
+	}
+
+	m.Elem, data = data[0], data[1:]
+	m.Items = nil
+
+	for len(data) > 0 {
+		item, rest, err := decodeFrame(data, nest.inside())
+		if err != nil {
+			return err
+		}
+		err = m.Append(item)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		data = rest
+	}
+	return nil
+}
+
+// Map is a set of payloads keyed by strings. It is encoded as a String frame
+// for each key followed by a frame for its value, sorted by key so that equal
+// maps encode to the same bytes. Keys with a nil value are left out.
+type Map map[string]Payload
+
+// keys returns the sorted keys of the values that aren't nil.
+func (m Map) keys() []string {
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (m Map) Bytes() []byte {
+	var b []byte
+	for _, k := range m.keys() {
+		key := String(k)
+		b = AppendFrame(b, &key)
+		b = AppendFrame(b, m[k])
+	}
+	return b
+}
+
+func (m Map) String() string {
+	keys := m.keys()
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + ":" + m[k].String()
+	}
+	return "map[" + strings.Join(pairs, " ") + "]"
+}
+
+func (m Map) Type() uint8 { return MapType }
+
+func (m Map) validate() error {
+	for _, v := range m {
+		err := validateAll(v)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m Map) WriteTo(w io.Writer) (int64, error)   { return WriteFrame(w, &m) }
+func (m *Map) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *Map) UnmarshalBinary(data []byte) error { return m.unmarshalAt(data, topLevel()) }
+
+func (m *Map) unmarshalAt(data []byte, nest nesting) error {
+	*m = make(Map)
+
+	for len(data) > 0 {
+		typ, key, rest, err := NextFrame(data)
+		if err != nil {
+			return err
+		}
+		if typ != StringType {
+			return fmt.Errorf("%w: Map key must be a String, got type %d", ErrInvalidPayload, typ)
+		}
+		if _, ok := (*m)[string(key)]; ok {
+			return fmt.Errorf("%w: duplicate Map key %q", ErrInvalidPayload, key)
+		}
+
+		value, rest, err := decodeFrame(rest, nest.inside())
+		if err != nil {
+			return err
+		}
+
+		(*m)[string(key)] = value
+		data = rest
+	}
+	return nil
+}
+
+// Field is a value in a Record identified by its tag.
+type Field struct {
+	Tag   uint16
+	Value Payload
+}
+
+// Record is a set of tagged fields, like the fields of a struct. It is encoded
+// as a 2-byte tag followed by a frame for the value of each field. A field
+// whose type isn't registered is kept as Raw, so records from a newer peer
+// can still be read. Fields with a nil value are left out.
+type Record []Field
+
+// Get returns the value of the field with the given tag.
+func (m Record) Get(tag uint16) (Payload, bool) {
+	for _, f := range m {
+		if f.Tag == tag {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (m Record) Bytes() []byte {
+	var b []byte
+	for _, f := range m {
+		if f.Value != nil {
+			b = AppendField(b, f.Tag, f.Value)
+		}
+	}
+	return b
+}
+
+func (m Record) String() string {
+	fields := make([]string, 0, len(m))
+	for _, f := range m {
+		if f.Value != nil {
+			fields = append(fields, fmt.Sprintf("%d:%s", f.Tag, f.Value))
+		}
+	}
+	return "{" + strings.Join(fields, " ") + "}"
+}
+
+func (m Record) Type() uint8 { return RecordType }
+
+func (m Record) validate() error {
+	for _, f := range m {
+		err := validateAll(f.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m Record) WriteTo(w io.Writer) (int64, error)   { return WriteFrame(w, &m) }
+func (m *Record) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *Record) UnmarshalBinary(data []byte) error { return m.unmarshalAt(data, topLevel()) }
+
+func (m *Record) unmarshalAt(data []byte, nest nesting) error {
+	*m = nil
+
+	for len(data) > 0 {
+		tag, typ, body, rest, err := NextField(data)
+		if err != nil {
+			return err
+		}
+
+		value, err := nest.new(typ)
+		switch {
+		case errors.Is(err, ErrUnknownType):
+			value = &Raw{Typ: typ, Body: append([]byte(nil), body...)}
+		case err != nil:
+			return err
+		default:
+			err = unmarshalAt(value, body, nest.inside())
+			if err != nil {
+				return err
+			}
+		}
+
+		*m = append(*m, Field{Tag: tag, Value: value})
+		data = rest
+	}
+	return nil
+}
+
+// AppendField appends p to b as a Record field with the given tag.
+func AppendField(b []byte, tag uint16, p Payload) []byte {
+	b = binary.BigEndian.AppendUint16(b, tag)
+	return AppendFrame(b, p)
+}
+
+// NextField splits the first Record field off of data, returning its tag, the
+// type and body of its value and what follows it.
+func NextField(data []byte) (uint16, uint8, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, 0, nil, nil, fmt.Errorf("%w: truncated Record tag", ErrInvalidPayload)
+	}
+	tag := binary.BigEndian.Uint16(data)
+
+	typ, body, rest, err := NextFrame(data[2:])
+	if err != nil {
+		return 0, 0, nil, nil, err
+	}
+	return tag, typ, body, rest, nil
+}
+
+// Raw is a frame of a type that isn't known to the registry, holding its body
+// as is so it can be passed on or ignored.
+type Raw struct {
+	Typ  uint8
+	Body []byte
+}
+
+func (m *Raw) Bytes() []byte  { return m.Body }
+func (m *Raw) String() string { return fmt.Sprintf("raw(%d)%x", m.Typ, m.Body) }
+func (m *Raw) Type() uint8    { return m.Typ }
+
+func (m *Raw) WriteTo(w io.Writer) (int64, error) { return WriteFrame(w, m) }
+
+// ReadFrom reads a frame of any type into m.
+func (m *Raw) ReadFrom(r io.Reader) (int64, error) {
+	typ, sz, n, err := readHeader(r, MaxPayloadSize)
+	if err != nil {
+		return n, err
+	}
+	body, o, err := readBody(r, sz)
+	if err != nil {
+		return n + o, err
+	}
+	m.Typ, m.Body = typ, body
+	return n + o, nil
+}
+
+func (m *Raw) UnmarshalBinary(data []byte) error {
+	m.Body = append(m.Body[:0], data...)
+	return nil
+}
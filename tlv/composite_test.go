@@ -0,0 +1,248 @@
+package tlv_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func decodeOne(t *testing.T, p tlv.Payload) (tlv.Payload, error) {
+	t.Helper()
+	return tlv.NewDecoder(bytes.NewReader(encode(t, p))).Decode()
+}
+
+func TestCompositesRoundTrip(t *testing.T) {
+	ports, err := tlv.NewList(tlv.Uint16Type, ptr(tlv.Uint16(80)), ptr(tlv.Uint16(443)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := tlv.Map{
+		"env":  ptr(tlv.String("prod")),
+		"zone": ptr(tlv.String("us-east-1a")),
+	}
+
+	owner := tlv.Record{
+		{Tag: 1, Value: ptr(tlv.String("gopher"))},
+		{Tag: 2, Value: ptr(tlv.Bool(true))},
+	}
+
+	service := tlv.Record{
+		{Tag: 1, Value: ptr(tlv.String("web"))},
+		{Tag: 2, Value: ports},
+		{Tag: 3, Value: &labels},
+		{Tag: 4, Value: &owner},
+		{Tag: 5, Value: new(tlv.List)}, // an empty list
+	}
+
+	got, err := decodeOne(t, &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "{1:web 2:[80 443] 3:map[env:prod zone:us-east-1a] 4:{1:gopher 2:true} 5:[]}"
+	if got.String() != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	rec, ok := got.(*tlv.Record)
+	if !ok {
+		t.Fatalf("expected *tlv.Record, got %T", got)
+	}
+	l, ok := rec.Get(2)
+	if !ok {
+		t.Fatal("expected field 2 to be set")
+	}
+	if elem := l.(*tlv.List).Elem; elem != tlv.Uint16Type {
+		t.Errorf("expected list of type %d, got %d", tlv.Uint16Type, elem)
+	}
+	if !bytes.Equal(got.Bytes(), service.Bytes()) {
+		t.Error("expected the decoded record to encode to the same bytes")
+	}
+}
+
+func TestMapEncodingIsDeterministic(t *testing.T) {
+	m := tlv.Map{}
+	for _, k := range []string{"d", "a", "c", "b", "e"} {
+		m[k] = ptr(tlv.String(k))
+	}
+
+	first := m.Bytes()
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(first, m.Bytes()) {
+			t.Fatal("expected the same encoding every time")
+		}
+	}
+}
+
+func TestMapLeavesOutNilValues(t *testing.T) {
+	m := tlv.Map{"set": ptr(tlv.Bool(true)), "unset": nil}
+	if m.String() != "map[set:true]" {
+		t.Errorf("expected the nil value left out, got %s", m)
+	}
+
+	got, err := decodeOne(t, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "map[set:true]" {
+		t.Errorf("expected the nil value left out, got %s", got)
+	}
+}
+
+func TestRecordLeavesOutNilValues(t *testing.T) {
+	rec := tlv.Record{{Tag: 1}, {Tag: 2, Value: ptr(tlv.Bool(true))}}
+	if rec.String() != "{2:true}" {
+		t.Errorf("expected the nil field left out, got %s", rec)
+	}
+
+	got, err := decodeOne(t, &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "{2:true}" {
+		t.Errorf("expected the nil field left out, got %s", got)
+	}
+}
+
+func TestListRejectsNilItems(t *testing.T) {
+	if _, err := tlv.NewList(tlv.StringType, nil); err == nil {
+		t.Error("expected an error adding a nil item to a list")
+	}
+
+	// items set directly are left out instead
+	l := &tlv.List{Elem: tlv.StringType, Items: []tlv.Payload{nil, ptr(tlv.String("a"))}}
+	got, err := decodeOne(t, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "[a]" {
+		t.Errorf("expected the nil item left out, got %s", got)
+	}
+}
+
+func TestListRejectsItemsOfAnotherType(t *testing.T) {
+	_, err := tlv.NewList(tlv.StringType, ptr(tlv.String("a")), ptr(tlv.Int8(1)))
+	if err == nil {
+		t.Fatal("expected an error adding an Int8 to a list of Strings")
+	}
+
+	// a peer that ignores the element type
+	body := append([]byte{tlv.StringType}, encode(t, ptr(tlv.Int8(1)))...)
+	var l tlv.List
+	err = l.UnmarshalBinary(body)
+	if !errors.Is(err, tlv.ErrInvalidPayload) {
+		t.Errorf("expected ErrInvalidPayload, got %v", err)
+	}
+}
+
+func TestCompositesEnforceMaxDepth(t *testing.T) {
+	nest := func(depth int) tlv.Payload {
+		var p tlv.Payload = ptr(tlv.Bool(true))
+		for i := 0; i < depth; i++ {
+			p = &tlv.List{Elem: p.Type(), Items: []tlv.Payload{p}}
+		}
+		return p
+	}
+
+	_, err := decodeOne(t, nest(tlv.MaxDepth))
+	if err != nil {
+		t.Errorf("expected lists nested %d deep to decode, got %v", tlv.MaxDepth, err)
+	}
+
+	_, err = decodeOne(t, nest(tlv.MaxDepth+1))
+	if !errors.Is(err, tlv.ErrMaxDepth) {
+		t.Errorf("expected ErrMaxDepth, got %v", err)
+	}
+}
+
+func TestCompositesCountNestedSizesTowardsMaxPayloadSize(t *testing.T) {
+	half := tlv.Binary(make([]byte, tlv.MaxPayloadSize/2))
+	l, err := tlv.NewList(tlv.BinaryType, &half, &half)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = tlv.NewEncoder(&buf).Encode(l)
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written, got %d bytes", buf.Len())
+	}
+}
+
+// hugeBody returns a body too large for an item header. Its pages are never
+// touched, so it costs address space rather than memory.
+func hugeBody(t *testing.T) *tlv.Binary {
+	t.Helper()
+	if testing.Short() || math.MaxInt <= math.MaxUint32 {
+		t.Skip("needs a 4 GiB allocation")
+	}
+	b := tlv.Binary(make([]byte, math.MaxUint32+1))
+	return &b
+}
+
+func TestAppendFramePanicsOnBodiesTooLargeToFrame(t *testing.T) {
+	body := hugeBody(t)
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+			t.Errorf("expected a panic with ErrMaxPayloadSize, got %v", err)
+		}
+	}()
+	tlv.AppendFrame(nil, body)
+}
+
+func TestCompositesRefuseItemsTooLargeToFrame(t *testing.T) {
+	rec := tlv.Record{{Tag: 1, Value: hugeBody(t)}}
+
+	var buf bytes.Buffer
+	err := tlv.NewEncoder(&buf).Encode(&rec)
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("Encode: expected ErrMaxPayloadSize, got %v", err)
+	}
+	_, err = tlv.WriteFrame(&buf, &rec)
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("WriteFrame: expected ErrMaxPayloadSize, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing to be written, got %d bytes", buf.Len())
+	}
+}
+
+func TestRecordKeepsUnknownFieldTypes(t *testing.T) {
+	rec := tlv.Record{
+		{Tag: 1, Value: ptr(tlv.String("known"))},
+		{Tag: 2, Value: &tlv.Raw{Typ: 200, Body: []byte("from the future")}},
+	}
+
+	got, err := decodeOne(t, &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, _ := got.(*tlv.Record).Get(2)
+	raw, ok := v.(*tlv.Raw)
+	if !ok || raw.Typ != 200 || string(raw.Body) != "from the future" {
+		t.Errorf("expected the unknown field to be kept as Raw, got %#v", v)
+	}
+	if !bytes.Equal(got.Bytes(), rec.Bytes()) {
+		t.Error("expected the decoded record to encode to the same bytes")
+	}
+}
+
+func TestCompositesRejectTruncatedBodies(t *testing.T) {
+	rec := tlv.Record{{Tag: 1, Value: ptr(tlv.String("truncated"))}}
+	body := rec.Bytes()
+
+	var got tlv.Record
+	err := got.UnmarshalBinary(body[:len(body)-1])
+	if !errors.Is(err, tlv.ErrInvalidPayload) {
+		t.Errorf("expected ErrInvalidPayload, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package tlv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compressed is a payload sent gzipped. It is encoded as the type of the
+// payload followed by its body, gzipped. Decoders hand back the payload
+// inside rather than the Compressed, and refuse frames whose Compressed
+// payloads, nested ones included, inflate past their MaxPayloadSize between
+// them. Payload must not be nil or another Compressed, which encoders refuse.
+type Compressed struct {
+	Payload Payload
+}
+
+func (m *Compressed) Bytes() []byte {
+	if m.Payload == nil {
+		return nil
+	}
+	return compress(m.Payload.Type(), m.Payload.Bytes())
+}
+
+func (m *Compressed) String() string { return fmt.Sprintf("gzip(%v)", m.Payload) }
+func (m *Compressed) Type() uint8    { return CompressedType }
+
+func (m *Compressed) validate() error {
+	switch {
+	case m.Payload == nil:
+		return fmt.Errorf("%w: Compressed is missing its payload", ErrInvalidPayload)
+	case m.Payload.Type() == CompressedType:
+		return fmt.Errorf("%w: Compressed can't hold another Compressed", ErrInvalidPayload)
+	}
+	return validate(m.Payload)
+}
+
+func (m *Compressed) WriteTo(w io.Writer) (int64, error)  { return WriteFrame(w, m) }
+func (m *Compressed) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *Compressed) UnmarshalBinary(data []byte) error { return m.unmarshalAt(data, topLevel()) }
+
+func (m *Compressed) unmarshalAt(data []byte, nest nesting) error {
+	typ, body, err := nest.decompress(data)
+	if err != nil {
+		return err
+	}
+	p, err := nest.new(typ)
+	if err != nil {
+		return err
+	}
+	err = unmarshalAt(p, body, nest)
+	if err != nil {
+		return err
+	}
+	m.Payload = p
+	return nil
+}
+
+// compress returns the body of a Compressed frame holding a payload of type
+// typ with the given body.
+func compress(typ uint8, body []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(typ)
+
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(body) // writes to a bytes.Buffer don't fail
+	_ = zw.Close()
+
+	return buf.Bytes()
+}
+
+// decompress returns the type and the inflated body held in the body of a
+// Compressed frame, refusing to inflate more than max bytes.
+func decompress(data []byte, max uint32) (uint8, []byte, error) {
+	if len(data) < 1 {
+		return 0, nil, fmt.Errorf("%w: Compressed is missing its type", ErrInvalidPayload)
+	}
+	if data[0] == CompressedType {
+		return 0, nil, fmt.Errorf("%w: Compressed can't hold another Compressed", ErrInvalidPayload)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(zr, int64(max)+1))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if uint64(len(body)) > uint64(max) {
+		return 0, nil, ErrMaxPayloadSize
+	}
+	return data[0], body, nil
+}
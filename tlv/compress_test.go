@@ -0,0 +1,150 @@
+package tlv_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func TestEncoderCompressesAboveThreshold(t *testing.T) {
+	blob := tlv.Binary(bytes.Repeat([]byte(`{"key":"value"},`), 64<<10)) // 1MB of JSON-ish text
+	small := tlv.Binary("too small to bother")
+
+	var buf bytes.Buffer
+	enc := tlv.NewEncoder(&buf, tlv.WithCompression(1024))
+	for _, p := range []tlv.Payload{&blob, &small} {
+		if err := enc.Encode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if buf.Len() >= len(blob)/10 {
+		t.Errorf("expected the blob to compress well, wrote %d bytes", buf.Len())
+	}
+	if got := buf.Bytes()[0]; got != tlv.CompressedType {
+		t.Errorf("expected a Compressed frame, got type %d", got)
+	}
+
+	dec := tlv.NewDecoder(&buf)
+	for _, want := range []*tlv.Binary{&blob, &small} {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, ok := got.(*tlv.Binary)
+		if !ok {
+			t.Fatalf("expected *tlv.Binary, got %T", got)
+		}
+		if !bytes.Equal(*b, *want) {
+			t.Errorf("expected %d bytes back, got %d", len(*want), len(*b))
+		}
+	}
+}
+
+func TestEncoderSkipsCompressionThatDoesNotHelp(t *testing.T) {
+	// random data doesn't get any smaller
+	p := make(tlv.Binary, 8192)
+	_, _ = rand.New(rand.NewSource(1)).Read(p)
+
+	var buf bytes.Buffer
+	if err := tlv.NewEncoder(&buf, tlv.WithCompression(1)).Encode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.Bytes()[0]; got != tlv.BinaryType {
+		t.Errorf("expected a Binary frame, got type %d", got)
+	}
+}
+
+func TestDecoderLimitsDecompressedSize(t *testing.T) {
+	// a small frame that inflates past MaxPayloadSize
+	var body bytes.Buffer
+	body.WriteByte(tlv.BinaryType)
+	zw := gzip.NewWriter(&body)
+	_, _ = zw.Write(make([]byte, tlv.MaxPayloadSize+1))
+	_ = zw.Close()
+
+	bomb := encode(t, &tlv.Raw{Typ: tlv.CompressedType, Body: body.Bytes()})
+	if len(bomb) > 64<<10 {
+		t.Fatalf("expected a small frame, got %d bytes", len(bomb))
+	}
+
+	_, err := tlv.NewDecoder(bytes.NewReader(bomb)).Decode()
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize, got %v", err)
+	}
+
+	// the limit is the decoder's, not the package's
+	p := tlv.Binary(make([]byte, 1024))
+	_, err = tlv.NewDecoder(bytes.NewReader(encode(t, &tlv.Compressed{Payload: &p})),
+		tlv.WithMaxPayloadSize(512)).Decode()
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize, got %v", err)
+	}
+}
+
+func TestCompressedNestsInContainers(t *testing.T) {
+	text := tlv.String(bytes.Repeat([]byte("compress me "), 100))
+	rec := tlv.Record{{Tag: 1, Value: &tlv.Compressed{Payload: &text}}}
+
+	got, err := decodeOne(t, &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, _ := got.(*tlv.Record).Get(1)
+	c, ok := v.(*tlv.Compressed)
+	if !ok {
+		t.Fatalf("expected *tlv.Compressed, got %T", v)
+	}
+	if c.Payload.String() != string(text) {
+		t.Errorf("expected the text back, got %q", c.Payload)
+	}
+}
+
+func TestDecoderLimitsDecompressedSizeOfNestedPayloads(t *testing.T) {
+	// each field inflates to under the limit, all of them together to over it
+	p := tlv.Binary(make([]byte, 300<<10))
+	var rec tlv.Record
+	for tag := uint16(1); tag <= 5; tag++ {
+		rec = append(rec, tlv.Field{Tag: tag, Value: &tlv.Compressed{Payload: &p}})
+	}
+	wire := encode(t, &rec)
+
+	_, err := tlv.NewDecoder(bytes.NewReader(wire), tlv.WithMaxPayloadSize(1<<20)).Decode()
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize, got %v", err)
+	}
+
+	_, err = tlv.NewDecoder(bytes.NewReader(wire), tlv.WithMaxPayloadSize(2<<20)).Decode()
+	if err != nil {
+		t.Errorf("expected the record to fit in a larger limit, got %v", err)
+	}
+}
+
+func TestEncoderRefusesCompressedItCantDecode(t *testing.T) {
+	text := tlv.String("text")
+	for _, p := range []tlv.Payload{
+		&tlv.Compressed{},
+		&tlv.Compressed{Payload: &tlv.Compressed{Payload: &text}},
+		&tlv.Record{{Tag: 1, Value: &tlv.Compressed{}}},
+	} {
+		if p.String() == "" {
+			t.Errorf("%T: expected a description", p)
+		}
+
+		var buf bytes.Buffer
+		if err := tlv.NewEncoder(&buf).Encode(p); !errors.Is(err, tlv.ErrInvalidPayload) {
+			t.Errorf("%v: expected ErrInvalidPayload, got %v", p, err)
+		}
+		if _, err := p.WriteTo(&buf); !errors.Is(err, tlv.ErrInvalidPayload) {
+			t.Errorf("%v: expected ErrInvalidPayload from WriteTo, got %v", p, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%v: expected nothing written, got %d bytes", p, buf.Len())
+		}
+	}
+}
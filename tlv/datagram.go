@@ -0,0 +1,99 @@
+package tlv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+)
+
+// MaxDatagramSize is the largest datagram read by a DatagramDecoder, the
+// most a UDP datagram can carry over IPv4.
+const MaxDatagramSize = 65507
+
+var ErrMaxDatagramSize = errors.New("frame exceeds datagram size")
+
+// DatagramDecoder reads frames from a datagram transport such as udp or
+// unixgram, where each datagram holds one or more complete frames.
+type DatagramDecoder struct {
+	conn net.PacketConn
+	opts []decoderOption
+	buf  []byte
+
+	dec  *Decoder // the rest of the current datagram, nil between datagrams
+	size int64    // the size of the current datagram
+	addr net.Addr // where the current datagram came from
+}
+
+// NewDatagramDecoder returns a decoder for the datagrams received by conn,
+// decoding the frames in each with a Decoder using opts.
+func NewDatagramDecoder(conn net.PacketConn, opts ...decoderOption) *DatagramDecoder {
+	return &DatagramDecoder{conn: conn, opts: opts, buf: make([]byte, MaxDatagramSize)}
+}
+
+// Decode returns the next payload and the address of the datagram it came
+// in, reading another datagram once the last one is used up. A frame claiming
+// more than is left of its datagram is rejected with ErrMaxPayloadSize
+// without looking at its body. Errors about a frame drop the rest of its
+// datagram, except ErrUnknownType and ErrUnsupportedType which skip just that
+// frame, and come with the datagram's address; errors reading a datagram come
+// with a nil address.
+func (d *DatagramDecoder) Decode() (Payload, net.Addr, error) {
+	for {
+		if d.dec == nil {
+			n, addr, err := d.conn.ReadFrom(d.buf)
+			if err != nil {
+				return nil, nil, err
+			}
+			d.dec = NewDecoder(bytes.NewReader(d.buf[:n]), d.opts...)
+			d.size, d.addr = int64(n), addr
+		}
+
+		p, err := d.decode()
+		switch {
+		case err == io.EOF:
+			d.dec = nil
+			continue
+		case err != nil && !errors.Is(err, ErrUnknownType) && !errors.Is(err, ErrUnsupportedType):
+			d.dec = nil
+		}
+		return p, d.addr, err
+	}
+}
+
+// decode decodes the next frame of the current datagram, limiting its size to
+// what's left of the datagram.
+func (d *DatagramDecoder) decode() (Payload, error) {
+	overhead := int64(HeaderSize)
+	if d.dec.varint {
+		overhead = 2 // the smallest a varint header can be
+	}
+	if d.dec.checksum {
+		overhead += 2 * ChecksumSize
+	}
+	left := d.size - d.dec.read - overhead
+	if left < 0 {
+		// not even a header is left, which Decode reports
+		left = 0
+	}
+	d.dec.maxPayloadSize = min(d.dec.maxPayloadSize, uint32(left))
+	return d.dec.Decode()
+}
+
+// packetWriter writes each write as a datagram to addr.
+type packetWriter struct {
+	conn net.PacketConn
+	addr net.Addr
+}
+
+func (w *packetWriter) Write(b []byte) (int, error) { return w.conn.WriteTo(b, w.addr) }
+
+// isDatagram reports whether network is a datagram network rather than a
+// stream one.
+func isDatagram(network string) bool {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package tlv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+// writes records each write made to it.
+type writes [][]byte
+
+func (w *writes) Write(b []byte) (int, error) {
+	*w = append(*w, bytes.Clone(b))
+	return len(b), nil
+}
+
+func TestEncoderWritesWholeDatagrams(t *testing.T) {
+	var w writes
+	enc := tlv.NewEncoder(&w, tlv.WithDatagrams(64), tlv.WithEncoderChecksum())
+
+	if err := enc.EncodeBatch(ptr(tlv.String("one")), ptr(tlv.String("two"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(ptr(tlv.Binary(make([]byte, 64)))); !errors.Is(err, tlv.ErrMaxDatagramSize) {
+		t.Errorf("expected ErrMaxDatagramSize, got %v", err)
+	}
+	// the second frame doesn't fit alongside the first, so neither is sent
+	err := enc.EncodeBatch(ptr(tlv.Binary(make([]byte, 30))), ptr(tlv.Binary(make([]byte, 30))))
+	if !errors.Is(err, tlv.ErrMaxDatagramSize) {
+		t.Errorf("expected ErrMaxDatagramSize, got %v", err)
+	}
+	if err := enc.EncodeStream(tlv.NewStream(bytes.NewReader([]byte("three")), 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(w) != 2 {
+		t.Fatalf("expected 2 writes, got %d", len(w))
+	}
+	dec := tlv.NewDecoder(bytes.NewReader(w[0]), tlv.WithChecksum())
+	for _, want := range []string{"one", "two"} {
+		p, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != want {
+			t.Errorf("expected %q, got %q", want, p)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("expected the first datagram to hold two frames, got %v", err)
+	}
+}
+
+func TestDatagramDecoderRejectsOversizedFrames(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sender, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sender.Close()
+
+	var buf bytes.Buffer
+	enc := tlv.NewEncoder(&buf)
+	_ = enc.Encode(ptr(tlv.String("a")))
+	_ = enc.Encode(ptr(tlv.String("b")))
+	twoFrames := bytes.Clone(buf.Bytes())
+
+	// a header claiming a body longer than the rest of the datagram
+	oversized := []byte{tlv.StringType, 0, 0, 1, 0, 'c'}
+
+	for _, d := range [][]byte{oversized, twoFrames} {
+		if _, err := sender.Write(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := tlv.NewDatagramDecoder(conn)
+	_, addr, err := dec.Decode()
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize, got %v", err)
+	}
+	if addr.String() != sender.LocalAddr().String() {
+		t.Errorf("expected the error to come from %s, got %v", sender.LocalAddr(), addr)
+	}
+	for _, want := range []string{"a", "b"} {
+		p, _, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != want {
+			t.Errorf("expected %q, got %q", want, p)
+		}
+	}
+}
+
+func TestClientAndServerOverNetworks(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, tc := range []struct{ network, addr string }{
+		{"udp", "127.0.0.1:0"},
+		{"unix", filepath.Join(dir, "stream.sock")},
+		{"unixgram", filepath.Join(dir, "gram.sock")},
+	} {
+		t.Run(tc.network, func(t *testing.T) {
+			s, err := tlv.NewServer(echo,
+				tlv.WithNetwork(tc.network),
+				tlv.WithAddr(tc.addr),
+				tlv.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			errs := make(chan error, 1)
+			go func() { errs <- s.Run() }()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			c := tlv.NewClient(quiet,
+				tlv.WithClientNetwork(tc.network),
+				tlv.WithClientAddr(s.Addr().String()),
+			)
+			done := make(chan struct{})
+			go func() {
+				_ = c.Run(ctx)
+				close(done)
+			}()
+
+			for _, want := range []string{"one", "two"} {
+				if err := c.Send(ctx, ptr(tlv.String(want))); err != nil {
+					t.Fatal(err)
+				}
+				if got := <-c.Payloads(); got.String() != want {
+					t.Errorf("expected %q, got %q", want, got)
+				}
+			}
+
+			cancel()
+			<-done
+			if err := s.Shutdown(context.Background()); err != nil {
+				t.Error(err)
+			}
+			if err := <-errs; !errors.Is(err, tlv.ErrServerClosed) {
+				t.Errorf("expected ErrServerClosed, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package tlv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+var ErrMaxTotalSize = errors.New("maximum total size exceeded")
+
+// Decoder reads payloads from a stream of TLV frames. It buffers reads from
+// the underlying reader, so it may read past the last frame it decodes.
+//
+// After ErrMaxPayloadSize, ErrMaxTotalSize or an error reading from the
+// underlying reader the stream is at an unknown position, and the Decoder
+// shouldn't be used again. ErrChecksum is the exception, the Decoder finds
+// the next frame by itself.
+type Decoder struct {
+	r        *bufio.Reader
+	registry *Registry
+	checksum bool
+	resync   bool // the last header was corrupt, skip ahead to the next good one
+
+	maxPayloadSize uint32
+	maxTotalSize   int64 // 0 means no limit
+	read           int64 // bytes read from r so far
+
+	stream *streamReader // the body last handed out by DecodeStream
+	varint bool          // headers are in the varint layout
+
+	types           *TypeSet // the types accepted, nil accepts all of them
+	skipUnsupported bool
+}
+
+type decoderOption func(*Decoder)
+
+// WithRegistry sets the registry used to look up frame types, including
+// those nested in containers, by default this is the DefaultRegistry.
+func WithRegistry(r *Registry) decoderOption {
+	return func(d *Decoder) {
+		d.registry = r
+	}
+}
+
+// WithMaxPayloadSize sets the largest frame body the decoder accepts, by
+// default this is MaxPayloadSize. Payloads nested in Lists, Maps and Records
+// are part of the body of the frame they arrive in.
+func WithMaxPayloadSize(sz uint32) decoderOption {
+	return func(d *Decoder) {
+		d.maxPayloadSize = sz
+	}
+}
+
+// WithMaxTotalSize caps the number of bytes the decoder reads over its
+// lifetime, such as over a single connection. By default there is no cap.
+func WithMaxTotalSize(sz int64) decoderOption {
+	return func(d *Decoder) {
+		d.maxTotalSize = sz
+	}
+}
+
+// WithChecksum makes the decoder read frames written with
+// WithEncoderChecksum, verifying the CRC32C of each header and body.
+func WithChecksum() decoderOption {
+	return func(d *Decoder) {
+		d.checksum = true
+	}
+}
+
+// WithVarintHeader reads frame headers in the varint layout written by an
+// Encoder using WithEncoderVarintHeader. Frames whose header carries a type
+// of MinExtendedType or above are decoded as Extended.
+func WithVarintHeader() decoderOption {
+	return func(d *Decoder) {
+		d.varint = true
+	}
+}
+
+// WithTypes makes the decoder accept only frames of the types in set, such as
+// those negotiated by Handshake. Others return an error wrapping
+// ErrUnsupportedType, unless WithSkipUnsupported is used too. Compressed
+// frames are checked against both their own type and the one inside.
+func WithTypes(set TypeSet) decoderOption {
+	return func(d *Decoder) {
+		d.types = &set
+	}
+}
+
+// WithSkipUnsupported makes the decoder pass over frames of types rejected
+// by WithTypes instead of returning an error.
+func WithSkipUnsupported() decoderOption {
+	return func(d *Decoder) {
+		d.skipUnsupported = true
+	}
+}
+
+func NewDecoder(r io.Reader, opts ...decoderOption) *Decoder {
+	d := &Decoder{
+		r:              bufio.NewReader(r),
+		registry:       DefaultRegistry,
+		maxPayloadSize: MaxPayloadSize,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Decode reads the next frame and returns the payload registered for its
+// type. It returns io.EOF when the stream ends cleanly between frames, an
+// error wrapping ErrUnknownType for a type missing from the registry or
+// ErrUnsupportedType for one rejected by WithTypes, and
+// ErrMaxPayloadSize or ErrMaxTotalSize for frames over the decoder's limits.
+// Frames over a limit are rejected before their body is read. Compressed
+// frames are inflated, returning the payload inside, and fail with
+// ErrMaxPayloadSize if all the Compressed payloads in a frame, nested ones
+// included, inflate to more than the limit.
+//
+// With checksums on, a corrupt frame returns an error wrapping ErrChecksum.
+// A bad body leaves the stream at the next frame. A bad header means its
+// size can't be trusted, so the next call skips ahead a byte at a time until
+// it finds a header whose checksum matches.
+func (d *Decoder) Decode() (Payload, error) {
+	for {
+		payload, err := d.decode()
+		if errors.Is(err, errSkipped) {
+			continue
+		}
+		return payload, err
+	}
+}
+
+// errSkipped is returned by decode for a frame skipped as unsupported.
+var errSkipped = errors.New("frame skipped")
+
+func (d *Decoder) decode() (Payload, error) {
+	typ, sz, err := d.nextHeader(uint64(d.maxPayloadSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var trailer int64
+	if d.checksum {
+		trailer = ChecksumSize
+	}
+
+	if !d.supports(typ) {
+		err = d.discard(int64(sz) + trailer)
+		if err != nil {
+			return nil, err
+		}
+		return nil, d.unsupported(typ)
+	}
+
+	var payload Payload
+	if typ < MinExtendedType {
+		payload, err = d.registry.New(uint8(typ))
+		if err != nil {
+			// skip the body so the next frame can still be read
+			dErr := d.discard(int64(sz) + trailer)
+			if dErr != nil {
+				return nil, dErr
+			}
+			return nil, err
+		}
+	}
+
+	body, n, err := readBody(d.r, uint32(sz))
+	d.read += n
+	if err != nil {
+		return nil, err
+	}
+
+	if d.checksum {
+		err = d.verifyBody(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if typ >= MinExtendedType {
+		// the type came in the varint header, so the body is all there is
+		return &Extended{Typ: typ, Body: body}, nil
+	}
+
+	nest := newNesting(d.registry, d.types, d.maxPayloadSize)
+	if typ == uint64(CompressedType) {
+		// hand back what's inside, held to the same limit once inflated
+		var inner uint8
+		inner, body, err = nest.decompress(body)
+		if err != nil {
+			return nil, err
+		}
+		if !d.supports(uint64(inner)) {
+			return nil, d.unsupported(uint64(inner))
+		}
+		payload, err = d.registry.New(inner)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = unmarshalAt(payload, body, nest)
+	if err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// InputOffset returns the number of bytes of the underlying reader that have
+// been decoded, which is where the next frame starts once the last stream
+// handed out by DecodeStream has been read to the end.
+func (d *Decoder) InputOffset() int64 { return d.read }
+
+// supports reports whether frames of type typ are accepted, those of an
+// Extended type being accepted along with ExtendedType.
+func (d *Decoder) supports(typ uint64) bool {
+	if typ >= MinExtendedType {
+		typ = uint64(ExtendedType)
+	}
+	return d.types == nil || d.types.Has(uint8(typ))
+}
+
+// unsupported returns the error for a frame of type typ that isn't accepted,
+// once its body has been skipped.
+func (d *Decoder) unsupported(typ uint64) error {
+	if d.skipUnsupported {
+		return errSkipped
+	}
+	return fmt.Errorf("%w: %d", ErrUnsupportedType, typ)
+}
+
+// discard skips the next n bytes of the stream.
+func (d *Decoder) discard(n int64) error {
+	for n > 0 {
+		chunk := int(min(n, bodyChunkSize))
+		m, err := d.r.Discard(chunk)
+		d.read += int64(m)
+		n -= int64(m)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+	return nil
+}
+
+// nextHeader finishes off the body of a stream handed out by DecodeStream,
+// then reads the next frame header, rejecting sizes above max.
+func (d *Decoder) nextHeader(max uint64) (uint64, uint64, error) {
+	if d.stream != nil {
+		_, err := io.Copy(io.Discard, d.stream)
+		d.stream = nil
+		if err != nil && !errors.Is(err, ErrChecksum) {
+			return 0, 0, err
+		}
+	}
+
+	typ, sz, err := d.readHeader(max)
+	if err != nil {
+		return typ, sz, err
+	}
+
+	var trailer int64
+	if d.checksum {
+		trailer = ChecksumSize
+	}
+	// compare against what's left, as the size is big enough to overflow
+	if left := d.maxTotalSize - d.read - trailer; d.maxTotalSize > 0 && (left < 0 || sz > uint64(left)) {
+		return typ, sz, ErrMaxTotalSize
+	}
+	return typ, sz, nil
+}
+
+// readHeader reads the next frame header in the decoder's layout, along with
+// its checksum if checksums are on. After a corrupt header it skips bytes
+// until it finds one that checks out.
+func (d *Decoder) readHeader(max uint64) (uint64, uint64, error) {
+	for {
+		if d.maxTotalSize > 0 && d.read > d.maxTotalSize {
+			return 0, 0, ErrMaxTotalSize
+		}
+
+		header, typ, sz, n, err := d.peekHeader()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if d.checksum {
+			if n < 0 || crc32.Checksum(header[:n], castagnoli) != binary.BigEndian.Uint32(header[n:]) {
+				_, _ = d.r.Discard(1)
+				d.read++
+				if d.resync {
+					continue
+				}
+				d.resync = true
+				return 0, 0, fmt.Errorf("%w: frame header", ErrChecksum)
+			}
+			d.resync = false
+			n += ChecksumSize
+		} else if n < 0 {
+			return 0, 0, fmt.Errorf("%w: malformed frame header", ErrInvalidPayload)
+		}
+
+		_, _ = d.r.Discard(n)
+		d.read += int64(n)
+
+		if sz > max {
+			return typ, sz, ErrMaxPayloadSize
+		}
+		return typ, sz, nil
+	}
+}
+
+// peekHeader returns the bytes of the next frame header without consuming
+// them, followed by its checksum if checksums are on, and the parsed header
+// as parseHeader returns it. A varint header is peeked a byte at a time, so
+// a small frame isn't held up waiting on bytes the peer hasn't sent.
+func (d *Decoder) peekHeader() ([]byte, uint64, uint64, int, error) {
+	want := HeaderSize
+	if d.varint {
+		want = 1
+	}
+
+	for {
+		b, err := d.r.Peek(want)
+		if err != nil {
+			if len(b) == 0 {
+				return nil, 0, 0, 0, err
+			}
+			return nil, 0, 0, 0, unexpectedEOF(err)
+		}
+
+		typ, sz, n := parseHeader(b, d.varint)
+		switch {
+		case n == 0:
+			want++ // the uvarint goes on into the next byte
+		case n > 0 && d.checksum && want < n+ChecksumSize:
+			want = n + ChecksumSize
+		default:
+			return b, typ, sz, n, nil
+		}
+	}
+}
+
+// verifyBody reads the checksum following body and checks it matches.
+func (d *Decoder) verifyBody(body []byte) error {
+	var sum [ChecksumSize]byte
+	n, err := readFull(d.r, sum[:])
+	d.read += int64(n)
+	if err != nil {
+		return err
+	}
+	if crc32.Checksum(body, castagnoli) != binary.BigEndian.Uint32(sum[:]) {
+		return fmt.Errorf("%w: frame body", ErrChecksum)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package tlv
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Encoder writes payloads to a stream as TLV frames. Frames are buffered and
+// handed to the underlying writer in one piece, except those too large for
+// the buffer, which go out as a vectored write of header, body and checksum
+// in place of one write per buffer full.
+type Encoder struct {
+	w        *bufio.Writer
+	checksum bool
+	compress int      // compress bodies of at least this many bytes, 0 never does
+	types    *TypeSet // the types the peer accepts, nil for all of them
+	datagram int      // the most a write may carry, 0 for streams
+	varint   bool     // write headers in the varint layout
+
+	dst io.Writer // what w writes to
+
+	// scratch space, so encoding doesn't allocate
+	hdr     [maxVarintHeaderSize + ChecksumSize]byte
+	sum     [ChecksumSize]byte
+	scratch frameBuffer
+}
+
+type encoderOption func(*Encoder)
+
+// WithEncoderChecksum adds a CRC32C to the header and the body of each
+// frame, to be read by a Decoder using WithChecksum.
+func WithEncoderChecksum() encoderOption {
+	return func(e *Encoder) {
+		e.checksum = true
+	}
+}
+
+// WithEncoderVarintHeader writes frame headers in the varint layout, the type
+// and then the size of the body each as a uvarint, to be read by a Decoder
+// using WithVarintHeader. Small frames get a 2-byte header in place of 5, and
+// frames can carry the type of an Extended and streams can exceed 4GB.
+func WithEncoderVarintHeader() encoderOption {
+	return func(e *Encoder) {
+		e.varint = true
+	}
+}
+
+// WithCompression gzips payloads whose body is at least threshold bytes,
+// sending them as Compressed when that makes them smaller.
+func WithCompression(threshold int) encoderOption {
+	return func(e *Encoder) {
+		e.compress = threshold
+	}
+}
+
+// WithEncoderTypes makes the encoder refuse payloads whose type isn't in set,
+// such as those the peer accepted in Handshake, returning an error wrapping
+// ErrUnsupportedType without writing anything.
+func WithEncoderTypes(set TypeSet) encoderOption {
+	return func(e *Encoder) {
+		e.types = &set
+	}
+}
+
+// WithDatagrams makes each Encode, EncodeBatch and EncodeStream hand the
+// underlying writer exactly one write of at most max bytes, for datagram
+// transports such as udp and unixgram. Frames that don't fit are rejected
+// with ErrMaxDatagramSize before anything is written.
+func WithDatagrams(max int) encoderOption {
+	return func(e *Encoder) {
+		e.datagram = max
+	}
+}
+
+func NewEncoder(w io.Writer, opts ...encoderOption) *Encoder {
+	e := &Encoder{dst: w}
+	for _, opt := range opts {
+		opt(e)
+	}
+	// a datagram has to fit in the buffer to go out in one write
+	e.w = bufio.NewWriterSize(w, max(e.datagram, 4096))
+	return e
+}
+
+// Encode writes p as a single frame.
+func (e *Encoder) Encode(p Payload) error {
+	err := e.encode(p)
+	if err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// EncodeBatch writes ps as consecutive frames in a single write, so that with
+// WithDatagrams they share one datagram. If a payload can't be encoded, the
+// ones before it are still written, unless they would be sent as a datagram.
+func (e *Encoder) EncodeBatch(ps ...Payload) error {
+	for _, p := range ps {
+		err := e.encode(p)
+		if err != nil {
+			if e.datagram > 0 {
+				e.w.Reset(e.dst)
+				return err
+			}
+			return errors.Join(err, e.w.Flush())
+		}
+	}
+	return e.w.Flush()
+}
+
+// encode buffers p as a frame.
+func (e *Encoder) encode(p Payload) error {
+	err := e.check(p.Type())
+	if err != nil {
+		return err
+	}
+	err = validate(p)
+	if err != nil {
+		return err
+	}
+
+	body, err := e.body(p)
+	if err != nil {
+		return err
+	}
+	typ := uint64(p.Type())
+	if uint64(len(body)) > uint64(MaxPayloadSize) {
+		return ErrMaxPayloadSize
+	}
+	if e.compress > 0 && p.Type() != CompressedType && len(body) >= e.compress {
+		if z := compress(p.Type(), body); len(z) < len(body) {
+			typ, body = uint64(CompressedType), z
+		}
+	}
+	if ext, ok := p.(*Extended); ok && e.varint && typ == uint64(ExtendedType) && ext.Typ >= MinExtendedType {
+		// the varint header carries the type itself
+		typ, body = ext.Typ, ext.Body
+	}
+
+	header := e.header(typ, uint64(len(body)))
+	err = e.fits(len(header) + len(body))
+	if err != nil {
+		return err
+	}
+
+	var trailer []byte
+	if e.checksum {
+		binary.BigEndian.PutUint32(e.sum[:], crc32.Checksum(body, castagnoli))
+		trailer = e.sum[:]
+	}
+
+	if e.datagram == 0 && len(header)+len(body) > e.w.Available() {
+		// too large to buffer, so send it with a vectored write instead of
+		// one write per buffer full
+		err = e.w.Flush()
+		if err != nil {
+			return err
+		}
+		_, err = e.scratch.writeBuffers(e.dst, header, body, trailer)
+		return err
+	}
+
+	for _, b := range [][]byte{header, body, trailer} {
+		_, err = e.w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// body returns the body of p, appending it to a reused buffer where p allows.
+func (e *Encoder) body(p Payload) ([]byte, error) {
+	a, ok := p.(bodyAppender)
+	if !ok {
+		return bodyOf(p)
+	}
+	e.scratch.b = a.appendBody(e.scratch.b[:0])
+	body := e.scratch.b
+	if cap(e.scratch.b) > maxPooledBuffer {
+		e.scratch.b = nil
+	}
+	return body, nil
+}
+
+// header returns the header for a frame in the encoder's layout, followed by
+// its checksum if checksums are on.
+func (e *Encoder) header(typ, size uint64) []byte {
+	header := appendHeader(e.hdr[:0], typ, size, e.varint)
+	if e.checksum {
+		header = binary.BigEndian.AppendUint32(header, crc32.Checksum(header, castagnoli))
+	}
+	return header
+}
+
+func (e *Encoder) writeChecksum(sum uint32) error {
+	binary.BigEndian.PutUint32(e.sum[:], sum)
+	_, err := e.w.Write(e.sum[:])
+	return err
+}
+
+// fits returns ErrMaxDatagramSize if a frame of n bytes, not counting the
+// checksum of its body, doesn't fit in what's left of the datagram being
+// built.
+func (e *Encoder) fits(n int) error {
+	if e.datagram == 0 {
+		return nil
+	}
+	if e.checksum {
+		n += ChecksumSize
+	}
+	if e.w.Buffered()+n > e.datagram {
+		return ErrMaxDatagramSize
+	}
+	return nil
+}
+
+// check returns an error if the peer doesn't accept frames of type typ.
+func (e *Encoder) check(typ uint8) error {
+	if e.types != nil && !e.types.Has(typ) {
+		return fmt.Errorf("%w: %d", ErrUnsupportedType, typ)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package tlv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// MinExtendedType is the lowest type an Extended payload can have, the types
+// below it fitting in the 1-byte type of a frame.
+const MinExtendedType = math.MaxUint8 + 1
+
+// Extended is a payload of a type too large for the 1-byte type of a frame,
+// holding its body as is. An encoder using the varint header puts Typ in the
+// frame header itself. Otherwise it is sent as a frame of ExtendedType, whose
+// body is Typ as a uvarint followed by Body. Decoders accept either.
+type Extended struct {
+	Typ  uint64
+	Body []byte
+}
+
+func (m *Extended) Bytes() []byte  { return append(binary.AppendUvarint(nil, m.Typ), m.Body...) }
+func (m *Extended) String() string { return fmt.Sprintf("extended(%d)%x", m.Typ, m.Body) }
+func (m *Extended) Type() uint8    { return ExtendedType }
+
+func (m *Extended) WriteTo(w io.Writer) (int64, error)  { return WriteFrame(w, m) }
+func (m *Extended) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *Extended) UnmarshalBinary(data []byte) error {
+	typ, n := binary.Uvarint(data)
+	if n <= 0 || typ < MinExtendedType {
+		return fmt.Errorf("%w: bad extended type", ErrInvalidPayload)
+	}
+	m.Typ, m.Body = typ, append(m.Body[:0], data[n:]...)
+	return nil
+}
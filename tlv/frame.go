@@ -0,0 +1,235 @@
+package tlv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"net"
+	"sync"
+)
+
+// HeaderSize is the size of a frame header, a 1-byte type followed by a
+// 4-byte big-endian size.
+const HeaderSize = 5
+
+// ChecksumSize is the size of the CRC32C that follows both the header and the
+// body of a frame when checksums are on.
+const ChecksumSize = 4
+
+var ErrChecksum = errors.New("checksum mismatch")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// WriteFrame writes p to w as a single frame, a header followed by the body
+// returned by p.Bytes. It is the building block for Payload.WriteTo. Header
+// and body go out in one vectored write if w supports it, as a net.Conn does.
+func WriteFrame(w io.Writer, p Payload) (int64, error) {
+	if a, ok := p.(bodyAppender); ok {
+		return writeAppended(w, a)
+	}
+	err := validate(p)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := bodyOf(p)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(len(body)) > uint64(MaxPayloadSize) {
+		return 0, ErrMaxPayloadSize
+	}
+
+	fb := frameBuffers.Get().(*frameBuffer)
+	defer fb.release()
+
+	fb.b = appendHeader(fb.b[:0], uint64(p.Type()), uint64(len(body)), false)
+	return fb.writeBuffers(w, fb.b, body)
+}
+
+// bodyAppender is implemented by payloads that can append their body to a
+// buffer, which lets them be written without allocating one.
+type bodyAppender interface {
+	Type() uint8
+	appendBody(b []byte) []byte
+}
+
+// writeAppended writes m to w as a single frame, building it in a pooled
+// buffer. It's generic so that the payloads with value receivers can call it
+// without m escaping to the heap.
+func writeAppended[T bodyAppender](w io.Writer, m T) (int64, error) {
+	fb := frameBuffers.Get().(*frameBuffer)
+	defer fb.release()
+
+	// leave room for the header, which needs the size of the body
+	fb.b = m.appendBody(fb.b[:HeaderSize])
+	size := len(fb.b) - HeaderSize
+	if uint64(size) > uint64(MaxPayloadSize) {
+		return 0, ErrMaxPayloadSize
+	}
+	fb.b[0] = m.Type()
+	binary.BigEndian.PutUint32(fb.b[1:], uint32(size))
+
+	n, err := w.Write(fb.b)
+	return int64(n), err
+}
+
+// frameBuffer is scratch space for writing frames without allocating.
+type frameBuffer struct {
+	b   []byte // the header, and the body too for a bodyAppender
+	vec net.Buffers
+	arr [3][]byte // backs vec, which is used up as it's written
+}
+
+var frameBuffers = sync.Pool{
+	New: func() any { return &frameBuffer{b: make([]byte, 0, 64)} },
+}
+
+// maxPooledBuffer is the largest buffer kept for reuse, so one large body
+// doesn't pin its memory.
+const maxPooledBuffer = 64 << 10
+
+func (fb *frameBuffer) release() {
+	if cap(fb.b) <= maxPooledBuffer {
+		frameBuffers.Put(fb)
+	}
+}
+
+// writeBuffers writes bufs to w, in a single vectored write if w supports it
+// and one write each otherwise.
+func (fb *frameBuffer) writeBuffers(w io.Writer, bufs ...[]byte) (int64, error) {
+	fb.vec = fb.arr[:0]
+	for _, b := range bufs {
+		if len(b) > 0 {
+			fb.vec = append(fb.vec, b)
+		}
+	}
+	n, err := fb.vec.WriteTo(w)
+	fb.arr = [3][]byte{} // don't hold on to the body
+	return n, err
+}
+
+// appendHeader appends a frame header to b, in the varint layout if varint is
+// set: the type and then the size, each as a uvarint. Only the varint layout
+// can carry types above 255 and sizes above 4GB, which the caller checks.
+func appendHeader(b []byte, typ, size uint64, varint bool) []byte {
+	if varint {
+		b = binary.AppendUvarint(b, typ)
+		return binary.AppendUvarint(b, size)
+	}
+	b = append(b, uint8(typ))
+	return binary.BigEndian.AppendUint32(b, uint32(size))
+}
+
+// maxVarintHeaderSize is the largest a header in the varint layout can be.
+const maxVarintHeaderSize = 2 * binary.MaxVarintLen64
+
+// parseHeader parses the frame header at the start of b. n is the size of the
+// header, 0 if b is too short to hold all of it, and negative if it is
+// malformed, which includes sizes beyond math.MaxInt64 that no stream can
+// be read to the end of.
+func parseHeader(b []byte, varint bool) (typ, size uint64, n int) {
+	if !varint {
+		if len(b) < HeaderSize {
+			return 0, 0, 0
+		}
+		return uint64(b[0]), uint64(binary.BigEndian.Uint32(b[1:])), HeaderSize
+	}
+
+	typ, n = binary.Uvarint(b)
+	if n <= 0 {
+		return 0, 0, n
+	}
+	size, m := binary.Uvarint(b[n:])
+	if m <= 0 {
+		return 0, 0, m
+	}
+	if size > math.MaxInt64 {
+		return 0, 0, -1
+	}
+	return typ, size, n + m
+}
+
+// ReadFrame reads a single frame from r into p. The frame must be of p's
+// type. It is the building block for Payload.ReadFrom.
+func ReadFrame(r io.Reader, p Payload) (int64, error) {
+	typ, sz, n, err := readHeader(r, MaxPayloadSize)
+	if err != nil {
+		return n, err
+	}
+
+	if typ != p.Type() {
+		return n, fmt.Errorf("%w: %T can't be read from type %d", ErrInvalidPayload, p, typ)
+	}
+
+	body, o, err := readBody(r, sz)
+	if err != nil {
+		return n + o, err
+	}
+
+	return n + o, p.UnmarshalBinary(body)
+}
+
+// readHeader reads a frame header from r, rejecting sizes above max. A stream
+// that ends cleanly before the header returns io.EOF.
+func readHeader(r io.Reader, max uint32) (uint8, uint32, int64, error) {
+	var header [HeaderSize]byte
+
+	n, err := io.ReadFull(r, header[:])
+	if err != nil {
+		if n == 0 {
+			return 0, 0, 0, err
+		}
+		return 0, 0, int64(n), unexpectedEOF(err)
+	}
+
+	typ := header[0]
+	sz := binary.BigEndian.Uint32(header[1:])
+
+	if sz > max {
+		return typ, sz, int64(n), ErrMaxPayloadSize
+	}
+
+	return typ, sz, int64(n), nil
+}
+
+// bodyChunkSize is the most readBody allocates before any of the body has
+// arrived.
+const bodyChunkSize = 64 << 10 // 64KB
+
+// readBody reads the sz byte body of a frame from r. Large bodies are read
+// into a buffer that grows as the data arrives, so a peer can't make us
+// allocate up to MaxPayloadSize just by sending a header.
+func readBody(r io.Reader, sz uint32) ([]byte, int64, error) {
+	if sz <= bodyChunkSize {
+		body := make([]byte, sz)
+		n, err := readFull(r, body)
+		return body, int64(n), err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(bodyChunkSize)
+
+	n, err := io.CopyN(&buf, r, int64(sz))
+	return buf.Bytes(), n, unexpectedEOF(err)
+}
+
+// readFull reads exactly len(buf) bytes from r, a stream that ends before the
+// whole payload arrives is reported as io.ErrUnexpectedEOF.
+func readFull(r io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(r, buf)
+	return n, unexpectedEOF(err)
+}
+
+// unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF for reads made after the
+// start of a frame, where running out of data means the frame is truncated.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
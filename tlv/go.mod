@@ -1,3 +1,3 @@
 module github.com/jm96441n/networkProgrammingInGo/tlv
 
-go 1.19
+go 1.21
@@ -0,0 +1,188 @@
+package tlv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// ProtocolVersion is the newest version of the protocol this package speaks.
+const ProtocolVersion uint8 = 1
+
+// HelloSize is the size of the preamble sent by Handshake: 3 bytes of magic,
+// a 1-byte version, 4 bytes of features and a 32-byte set of types.
+const HelloSize = 40
+
+var helloMagic = [3]byte{'T', 'L', 'V'}
+
+var (
+	ErrHandshake       = errors.New("invalid handshake")
+	ErrVersion         = errors.New("unsupported protocol version")
+	ErrUnsupportedType = errors.New("unsupported type")
+)
+
+// Features are optional parts of the protocol a peer can speak.
+type Features uint32
+
+const (
+	FeatureChecksum     Features = 1 << iota // frames carry CRC32Cs, see WithChecksum
+	FeatureVarintHeader                      // frame headers are in the varint layout, see WithVarintHeader
+)
+
+// TypeSet is a set of type codes.
+type TypeSet [32]byte
+
+// NewTypeSet returns a set holding types.
+func NewTypeSet(types ...uint8) TypeSet {
+	var s TypeSet
+	for _, typ := range types {
+		s.Add(typ)
+	}
+	return s
+}
+
+func (s *TypeSet) Add(typ uint8)     { s[typ/8] |= 1 << (typ % 8) }
+func (s TypeSet) Has(typ uint8) bool { return s[typ/8]&(1<<(typ%8)) != 0 }
+
+// Intersect returns the types in both s and o.
+func (s TypeSet) Intersect(o TypeSet) TypeSet {
+	for i := range s {
+		s[i] &= o[i]
+	}
+	return s
+}
+
+// Len returns the number of types in the set.
+func (s TypeSet) Len() int {
+	n := 0
+	for _, b := range s {
+		n += bits.OnesCount8(b)
+	}
+	return n
+}
+
+// Types returns the set of types registered with r.
+func (r *Registry) Types() TypeSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var s TypeSet
+	for typ := range r.factories {
+		s.Add(typ)
+	}
+	return s
+}
+
+// Hello is the preamble each side of a connection sends in Handshake,
+// describing what it can speak. Types are the types it can decode.
+type Hello struct {
+	Version  uint8
+	Features Features
+	Types    TypeSet
+}
+
+// NewHello returns a Hello for the current version, the given features and
+// the types registered with the DefaultRegistry.
+func NewHello(features Features) Hello {
+	return Hello{Version: ProtocolVersion, Features: features, Types: DefaultRegistry.Types()}
+}
+
+func (h Hello) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 0, HelloSize)
+	b = append(b, helloMagic[:]...)
+	b = append(b, h.Version)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.Features))
+	return append(b, h.Types[:]...), nil
+}
+
+func (h *Hello) UnmarshalBinary(data []byte) error {
+	if len(data) != HelloSize || [3]byte(data) != helloMagic {
+		return ErrHandshake
+	}
+	h.Version = data[3]
+	h.Features = Features(binary.BigEndian.Uint32(data[4:]))
+	copy(h.Types[:], data[8:])
+	return nil
+}
+
+// Session is what both sides of a connection agreed on in Handshake.
+type Session struct {
+	Version  uint8    // the older of the two versions
+	Features Features // the features both speak
+	Types    TypeSet  // the types both can decode
+	Peer     Hello    // the peer's preamble as it was sent
+}
+
+// Handshake sends hello over rw and reads the peer's in return, which the
+// peer sends at the same time. It fails with ErrHandshake if the peer
+// doesn't send a valid preamble and ErrVersion if it only speaks a version
+// older than any we do.
+func Handshake(rw io.ReadWriter, hello Hello) (*Session, error) {
+	out, _ := hello.MarshalBinary()
+
+	// write while reading, so neither side waits on the other if its
+	// writes block
+	written := make(chan error, 1)
+	go func() {
+		_, err := rw.Write(out)
+		written <- err
+	}()
+
+	in := make([]byte, HelloSize)
+	_, err := io.ReadFull(rw, in)
+	if wErr := <-written; wErr != nil {
+		return nil, wErr
+	}
+	if err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: truncated preamble", ErrHandshake)
+		}
+		return nil, err
+	}
+
+	var peer Hello
+	err = peer.UnmarshalBinary(in)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Session{
+		Version:  min(hello.Version, peer.Version),
+		Features: hello.Features & peer.Features,
+		Types:    hello.Types.Intersect(peer.Types),
+		Peer:     peer,
+	}
+	if s.Version < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrVersion, peer.Version)
+	}
+	return s, nil
+}
+
+// NewDecoder returns a decoder for frames sent by the peer, accepting only
+// the negotiated types and features. opts are applied after those.
+func (s *Session) NewDecoder(r io.Reader, opts ...decoderOption) *Decoder {
+	base := []decoderOption{WithTypes(s.Types)}
+	if s.Features&FeatureChecksum != 0 {
+		base = append(base, WithChecksum())
+	}
+	if s.Features&FeatureVarintHeader != 0 {
+		base = append(base, WithVarintHeader())
+	}
+	return NewDecoder(r, append(base, opts...)...)
+}
+
+// NewEncoder returns an encoder for frames sent to the peer, refusing types
+// it can't decode and using the negotiated features. opts are applied after
+// those.
+func (s *Session) NewEncoder(w io.Writer, opts ...encoderOption) *Encoder {
+	base := []encoderOption{WithEncoderTypes(s.Types)}
+	if s.Features&FeatureChecksum != 0 {
+		base = append(base, WithEncoderChecksum())
+	}
+	if s.Features&FeatureVarintHeader != 0 {
+		base = append(base, WithEncoderVarintHeader())
+	}
+	return NewEncoder(w, append(base, opts...)...)
+}
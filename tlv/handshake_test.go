@@ -0,0 +1,205 @@
+package tlv_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func TestHandshakeNegotiatesCommonGround(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	local := tlv.Hello{
+		Version:  3,
+		Features: tlv.FeatureChecksum,
+		Types:    tlv.NewTypeSet(tlv.StringType, tlv.BoolType, tlv.Int8Type),
+	}
+	peer := tlv.Hello{
+		Version: 1,
+		Types:   tlv.NewTypeSet(tlv.StringType, tlv.BoolType, tlv.ListType),
+	}
+
+	peerSession := make(chan *tlv.Session, 1)
+	go func() {
+		s, err := tlv.Handshake(b, peer)
+		if err != nil {
+			t.Error(err)
+		}
+		peerSession <- s
+	}()
+
+	s, err := tlv.Handshake(a, local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := <-peerSession
+
+	for _, s := range []*tlv.Session{s, other} {
+		if s.Version != 1 {
+			t.Errorf("expected version 1, got %d", s.Version)
+		}
+		if s.Features != 0 {
+			t.Errorf("expected no features, got %b", s.Features)
+		}
+		if want := tlv.NewTypeSet(tlv.StringType, tlv.BoolType); s.Types != want {
+			t.Errorf("expected string and bool, got %d types", s.Types.Len())
+		}
+	}
+	if s.Peer != peer {
+		t.Errorf("expected peer hello %+v, got %+v", peer, s.Peer)
+	}
+}
+
+func TestHandshakeRejectsBadPreamble(t *testing.T) {
+	hello := tlv.NewHello(0)
+	v0 := tlv.Hello{Version: 0}
+
+	tests := []struct {
+		name string
+		peer []byte
+		want error
+	}{
+		{"bad magic", bytes.Repeat([]byte{'x'}, tlv.HelloSize), tlv.ErrHandshake},
+		{"truncated", []byte("TLV\x01"), tlv.ErrHandshake},
+		{"version 0", must(v0.MarshalBinary()), tlv.ErrVersion},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rw := &struct {
+				io.Reader
+				io.Writer
+			}{bytes.NewReader(tc.peer), io.Discard}
+
+			_, err := tlv.Handshake(rw, hello)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, err)
+			}
+		})
+	}
+}
+
+func must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestDecoderRejectsUnsupportedTypes(t *testing.T) {
+	var buf bytes.Buffer
+	enc := tlv.NewEncoder(&buf)
+	for _, p := range []tlv.Payload{ptr(tlv.String("a")), ptr(tlv.Int8(1)), ptr(tlv.String("b"))} {
+		if err := enc.Encode(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wire := buf.Bytes()
+	set := tlv.NewTypeSet(tlv.StringType)
+
+	dec := tlv.NewDecoder(bytes.NewReader(wire), tlv.WithTypes(set))
+	want := []error{nil, tlv.ErrUnsupportedType, nil, io.EOF}
+	for i, w := range want {
+		_, err := dec.Decode()
+		if !errors.Is(err, w) {
+			t.Errorf("frame %d: expected %v, got %v", i, w, err)
+		}
+	}
+
+	dec = tlv.NewDecoder(bytes.NewReader(wire), tlv.WithTypes(set), tlv.WithSkipUnsupported())
+	for _, w := range []string{"a", "b"} {
+		p, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != w {
+			t.Errorf("expected %q, got %q", w, p)
+		}
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestEncoderRefusesUnsupportedTypes(t *testing.T) {
+	var buf bytes.Buffer
+	enc := tlv.NewEncoder(&buf, tlv.WithEncoderTypes(tlv.NewTypeSet(tlv.StringType)))
+
+	if err := enc.Encode(ptr(tlv.Bool(true))); !errors.Is(err, tlv.ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing written, got %d bytes", buf.Len())
+	}
+}
+
+func TestClientAndServerHandshake(t *testing.T) {
+	s, err := tlv.NewServer(echo,
+		tlv.WithAddr("127.0.0.1:0"),
+		tlv.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		tlv.WithHandshake(tlv.NewHello(tlv.FeatureChecksum)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Run() }()
+	defer func() { _ = s.Shutdown(context.Background()) }()
+
+	// only strings are negotiated, so neither side may send bools
+	hello := tlv.NewHello(tlv.FeatureChecksum)
+	hello.Types = tlv.NewTypeSet(tlv.StringType)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := tlv.NewClient(tlv.WithClientAddr(s.Addr().String()), quiet, tlv.WithClientHandshake(hello))
+	go func() { _ = c.Run(ctx) }()
+
+	if err := c.Send(ctx, ptr(tlv.String("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-c.Payloads(); got.String() != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+
+	if err := c.Send(ctx, ptr(tlv.Bool(true))); !errors.Is(err, tlv.ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestServerShutdownInterruptsHandshakes(t *testing.T) {
+	// shutting down while connections start their handshake must not leave
+	// them waiting out the handshake timeout
+	for i := 0; i < 20; i++ {
+		s, err := tlv.NewServer(echo,
+			tlv.WithAddr("127.0.0.1:0"),
+			tlv.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+			tlv.WithHandshake(tlv.NewHello(tlv.FeatureChecksum)),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { _ = s.Run() }()
+
+		conn, err := net.Dial("tcp", s.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err = s.Shutdown(ctx)
+		cancel()
+		_ = conn.Close()
+		if err != nil {
+			t.Fatalf("expected the handshake to be interrupted, got %v", err)
+		}
+	}
+}
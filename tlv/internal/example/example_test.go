@@ -0,0 +1,97 @@
+package example_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+	"github.com/jm96441n/networkProgrammingInGo/tlv/internal/example"
+)
+
+func TestGeneratedPayloadRoundTrip(t *testing.T) {
+	want := &example.Service{
+		Name:    "web",
+		Ports:   []uint16{80, 443},
+		Owner:   &example.Owner{Name: "gopher", Admin: true, Uid: 1000, Parent: &example.Owner{Name: "root"}},
+		Backups: []example.Owner{{Name: "a"}, {Name: "b", Uid: 2}},
+		Started: time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC),
+		Weight:  0.5,
+		Config:  []byte(`{"debug":true}`),
+		Replica: -3,
+		Tags:    []string{"prod", "edge"},
+	}
+
+	var buf bytes.Buffer
+	if err := tlv.NewEncoder(&buf).Encode(want); err != nil {
+		t.Fatal(err)
+	}
+
+	// the generated types are registered, so a plain Decoder knows them
+	p, err := tlv.NewDecoder(&buf).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := p.(*example.Service)
+	if !ok {
+		t.Fatalf("expected *example.Service, got %T", p)
+	}
+	if got.String() != want.String() {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Error("expected the decoded service to encode to the same bytes")
+	}
+}
+
+func TestGeneratedPayloadIsARecord(t *testing.T) {
+	owner := &example.Owner{Name: "gopher", Uid: 7}
+
+	var rec tlv.Record
+	if err := rec.UnmarshalBinary(owner.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{1:gopher 2:false 3:7}"; rec.String() != want {
+		t.Errorf("expected %s, got %s", want, rec.String())
+	}
+
+	// and fields it doesn't know are skipped
+	rec = append(rec, tlv.Field{Tag: 99, Value: &tlv.Raw{Typ: 200, Body: []byte("new")}})
+	var got example.Owner
+	if err := got.UnmarshalBinary(rec.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if got != *owner {
+		t.Errorf("expected %s, got %s", owner, &got)
+	}
+}
+
+func TestGeneratedPayloadRejectsWrongTypes(t *testing.T) {
+	s := tlv.String("not a uint32")
+	rec := tlv.Record{{Tag: 3, Value: &s}}
+
+	var got example.Owner
+	err := got.UnmarshalBinary(rec.Bytes())
+	if !errors.Is(err, tlv.ErrInvalidPayload) {
+		t.Errorf("expected ErrInvalidPayload, got %v", err)
+	}
+}
+
+func TestGeneratedPayloadEnforcesMaxDepth(t *testing.T) {
+	nest := func(depth int) *example.Owner {
+		o := &example.Owner{}
+		for i := 1; i < depth; i++ {
+			o = &example.Owner{Parent: o}
+		}
+		return o
+	}
+
+	var got example.Owner
+	if err := got.UnmarshalBinary(nest(tlv.MaxDepth).Bytes()); err != nil {
+		t.Errorf("expected owners nested %d deep to decode, got %v", tlv.MaxDepth, err)
+	}
+	if err := got.UnmarshalBinary(nest(tlv.MaxDepth + 1).Bytes()); !errors.Is(err, tlv.ErrMaxDepth) {
+		t.Errorf("expected ErrMaxDepth, got %v", err)
+	}
+}
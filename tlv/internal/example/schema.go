@@ -0,0 +1,30 @@
+// Package example holds a schema for tlvgen and the payloads generated from
+// it, and is used to test them.
+package example
+
+import "time"
+
+//go:generate go run github.com/jm96441n/networkProgrammingInGo/tlv/cmd/tlvgen
+
+//tlv:type 64
+type Service struct {
+	Name    string            `tlv:"1"`
+	Ports   []uint16          `tlv:"2"`
+	Owner   *Owner            `tlv:"3"`
+	Backups []Owner           `tlv:"4"`
+	Started time.Time         `tlv:"5"`
+	Weight  float32           `tlv:"6"`
+	Config  []byte            `tlv:"7"`
+	Replica int               `tlv:"8"`
+	Tags    []string          `tlv:"9"`
+	cache   map[string]string // ignored
+}
+
+//tlv:type 65
+type Owner struct {
+	Name   string `tlv:"1"`
+	Admin  bool   `tlv:"2"`
+	Uid    uint32 `tlv:"3"`
+	Notes  string `tlv:"-"`
+	Parent *Owner `tlv:"4"`
+}
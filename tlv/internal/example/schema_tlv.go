@@ -0,0 +1,301 @@
+// Code generated by tlvgen from schema.go; DO NOT EDIT.
+
+package example
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func init() {
+	if err := tlv.Register(64, func() tlv.Payload { return new(Service) }); err != nil {
+		panic(err)
+	}
+	if err := tlv.Register(65, func() tlv.Payload { return new(Owner) }); err != nil {
+		panic(err)
+	}
+}
+
+func (m *Service) Type() uint8    { return 64 }
+func (m *Service) String() string { return fmt.Sprintf("%+v", *m) }
+
+func (m *Service) WriteTo(w io.Writer) (int64, error)  { return tlv.WriteFrame(w, m) }
+func (m *Service) ReadFrom(r io.Reader) (int64, error) { return tlv.ReadFrame(r, m) }
+
+func (m *Service) Bytes() []byte {
+	var b []byte
+	{
+		p := tlv.String(m.Name)
+		b = tlv.AppendField(b, 1, &p)
+	}
+	{
+		l := tlv.List{Elem: tlv.Uint16Type, Items: make([]tlv.Payload, len(m.Ports))}
+		for i, v := range m.Ports {
+			p := tlv.Uint16(v)
+			l.Items[i] = &p
+		}
+		b = tlv.AppendField(b, 2, &l)
+	}
+	if m.Owner != nil {
+		b = tlv.AppendField(b, 3, m.Owner)
+	}
+	{
+		l := tlv.List{Elem: 65, Items: make([]tlv.Payload, len(m.Backups))}
+		for i := range m.Backups {
+			l.Items[i] = &m.Backups[i]
+		}
+		b = tlv.AppendField(b, 4, &l)
+	}
+	{
+		p := tlv.Timestamp(m.Started)
+		b = tlv.AppendField(b, 5, &p)
+	}
+	{
+		p := tlv.Float64(m.Weight)
+		b = tlv.AppendField(b, 6, &p)
+	}
+	{
+		p := tlv.Binary(m.Config)
+		b = tlv.AppendField(b, 7, &p)
+	}
+	{
+		p := tlv.Varint(m.Replica)
+		b = tlv.AppendField(b, 8, &p)
+	}
+	{
+		l := tlv.List{Elem: tlv.StringType, Items: make([]tlv.Payload, len(m.Tags))}
+		for i, v := range m.Tags {
+			p := tlv.String(v)
+			l.Items[i] = &p
+		}
+		b = tlv.AppendField(b, 9, &l)
+	}
+	return b
+}
+
+func (m *Service) UnmarshalBinary(data []byte) error { return m.unmarshalTLV(data, 1) }
+
+func (m *Service) unmarshalTLV(data []byte, depth int) error {
+	if depth > tlv.MaxDepth {
+		return tlv.ErrMaxDepth
+	}
+
+	*m = Service{}
+	for len(data) > 0 {
+		tag, typ, body, rest, err := tlv.NextField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		switch tag {
+		case 1:
+			if typ != tlv.StringType {
+				return fmt.Errorf("%w: Service.Name has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.StringType)
+			}
+			var p tlv.String
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Name = string(p)
+		case 2:
+			if typ != tlv.ListType {
+				return fmt.Errorf("%w: Service.Ports has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.ListType)
+			}
+			if len(body) < 1 || body[0] != tlv.Uint16Type {
+				return fmt.Errorf("%w: Service.Ports must be a List of type %d", tlv.ErrInvalidPayload, tlv.Uint16Type)
+			}
+			for body = body[1:]; len(body) > 0; {
+				typ, item, rest, err := tlv.NextFrame(body)
+				if err != nil {
+					return err
+				}
+				body = rest
+
+				if typ != tlv.Uint16Type {
+					return fmt.Errorf("%w: Service.Ports has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.Uint16Type)
+				}
+				var p tlv.Uint16
+				if err := p.UnmarshalBinary(item); err != nil {
+					return err
+				}
+				m.Ports = append(m.Ports, uint16(p))
+			}
+		case 3:
+			if typ != 65 {
+				return fmt.Errorf("%w: Service.Owner has type %d, want %d", tlv.ErrInvalidPayload, typ, 65)
+			}
+			m.Owner = new(Owner)
+			if err := m.Owner.unmarshalTLV(body, depth+1); err != nil {
+				return err
+			}
+		case 4:
+			if typ != tlv.ListType {
+				return fmt.Errorf("%w: Service.Backups has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.ListType)
+			}
+			if len(body) < 1 || body[0] != 65 {
+				return fmt.Errorf("%w: Service.Backups must be a List of type %d", tlv.ErrInvalidPayload, 65)
+			}
+			for body = body[1:]; len(body) > 0; {
+				typ, item, rest, err := tlv.NextFrame(body)
+				if err != nil {
+					return err
+				}
+				body = rest
+
+				if typ != 65 {
+					return fmt.Errorf("%w: Service.Backups has type %d, want %d", tlv.ErrInvalidPayload, typ, 65)
+				}
+				var v Owner
+				if err := v.unmarshalTLV(item, depth+1); err != nil {
+					return err
+				}
+				m.Backups = append(m.Backups, v)
+			}
+		case 5:
+			if typ != tlv.TimestampType {
+				return fmt.Errorf("%w: Service.Started has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.TimestampType)
+			}
+			var p tlv.Timestamp
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Started = p.Time()
+		case 6:
+			if typ != tlv.Float64Type {
+				return fmt.Errorf("%w: Service.Weight has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.Float64Type)
+			}
+			var p tlv.Float64
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Weight = float32(p)
+		case 7:
+			if typ != tlv.BinaryType {
+				return fmt.Errorf("%w: Service.Config has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.BinaryType)
+			}
+			var p tlv.Binary
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Config = []byte(p)
+		case 8:
+			if typ != tlv.VarintType {
+				return fmt.Errorf("%w: Service.Replica has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.VarintType)
+			}
+			var p tlv.Varint
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Replica = int(p)
+		case 9:
+			if typ != tlv.ListType {
+				return fmt.Errorf("%w: Service.Tags has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.ListType)
+			}
+			if len(body) < 1 || body[0] != tlv.StringType {
+				return fmt.Errorf("%w: Service.Tags must be a List of type %d", tlv.ErrInvalidPayload, tlv.StringType)
+			}
+			for body = body[1:]; len(body) > 0; {
+				typ, item, rest, err := tlv.NextFrame(body)
+				if err != nil {
+					return err
+				}
+				body = rest
+
+				if typ != tlv.StringType {
+					return fmt.Errorf("%w: Service.Tags has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.StringType)
+				}
+				var p tlv.String
+				if err := p.UnmarshalBinary(item); err != nil {
+					return err
+				}
+				m.Tags = append(m.Tags, string(p))
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Owner) Type() uint8    { return 65 }
+func (m *Owner) String() string { return fmt.Sprintf("%+v", *m) }
+
+func (m *Owner) WriteTo(w io.Writer) (int64, error)  { return tlv.WriteFrame(w, m) }
+func (m *Owner) ReadFrom(r io.Reader) (int64, error) { return tlv.ReadFrame(r, m) }
+
+func (m *Owner) Bytes() []byte {
+	var b []byte
+	{
+		p := tlv.String(m.Name)
+		b = tlv.AppendField(b, 1, &p)
+	}
+	{
+		p := tlv.Bool(m.Admin)
+		b = tlv.AppendField(b, 2, &p)
+	}
+	{
+		p := tlv.Uint32(m.Uid)
+		b = tlv.AppendField(b, 3, &p)
+	}
+	if m.Parent != nil {
+		b = tlv.AppendField(b, 4, m.Parent)
+	}
+	return b
+}
+
+func (m *Owner) UnmarshalBinary(data []byte) error { return m.unmarshalTLV(data, 1) }
+
+func (m *Owner) unmarshalTLV(data []byte, depth int) error {
+	if depth > tlv.MaxDepth {
+		return tlv.ErrMaxDepth
+	}
+
+	*m = Owner{}
+	for len(data) > 0 {
+		tag, typ, body, rest, err := tlv.NextField(data)
+		if err != nil {
+			return err
+		}
+		data = rest
+
+		switch tag {
+		case 1:
+			if typ != tlv.StringType {
+				return fmt.Errorf("%w: Owner.Name has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.StringType)
+			}
+			var p tlv.String
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Name = string(p)
+		case 2:
+			if typ != tlv.BoolType {
+				return fmt.Errorf("%w: Owner.Admin has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.BoolType)
+			}
+			var p tlv.Bool
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Admin = bool(p)
+		case 3:
+			if typ != tlv.Uint32Type {
+				return fmt.Errorf("%w: Owner.Uid has type %d, want %d", tlv.ErrInvalidPayload, typ, tlv.Uint32Type)
+			}
+			var p tlv.Uint32
+			if err := p.UnmarshalBinary(body); err != nil {
+				return err
+			}
+			m.Uid = uint32(p)
+		case 4:
+			if typ != 65 {
+				return fmt.Errorf("%w: Owner.Parent has type %d, want %d", tlv.ErrInvalidPayload, typ, 65)
+			}
+			m.Parent = new(Owner)
+			if err := m.Parent.unmarshalTLV(body, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
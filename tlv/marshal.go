@@ -0,0 +1,570 @@
+package tlv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Marshal encodes the struct v, or a pointer to one, as a Record frame. Only
+// exported fields with a tlv tag giving their Record tag are encoded:
+//
+//	type Service struct {
+//		Name   string            `tlv:"1"`
+//		Ports  []uint16          `tlv:"2"`
+//		Labels map[string]string `tlv:"3"`
+//		Owner  *Owner            `tlv:"4"`
+//		cache  []byte            // ignored
+//		Notes  string            `tlv:"-"` // ignored
+//	}
+//
+// Go values map to payloads as follows:
+//
+//	bool                   Bool
+//	int8, int16, ...       Int8, Int16, ...
+//	uint8, uint16, ...     Uint8, Uint16, ...
+//	int, uint              Varint, Uvarint
+//	float32, float64       Float64
+//	string                 String
+//	[]byte                 Binary
+//	time.Time              Timestamp
+//	[]T                    List
+//	map[string]T           Map
+//	struct                 Record
+//
+// Values that implement Payload are encoded as themselves. Nil pointers,
+// interfaces and Payloads are left out of the record.
+func Marshal(v any) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("tlv: Marshal needs a struct, got %T", v)
+	}
+
+	rec, err := marshalRecord(rv)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	_, err = WriteFrame(&buf, &rec)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the Record frame in data into the struct v points to,
+// matching fields to struct fields by their tlv tag. Fields with tags that v
+// doesn't have are skipped, so a struct can be decoded from a newer version
+// of itself, and struct fields missing from the record are left untouched.
+// Integer fields accept any integer payload the value fits in.
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("tlv: Unmarshal needs a non-nil pointer to a struct, got %T", v)
+	}
+
+	var rec Record
+	n, err := ReadFrame(bytes.NewReader(data), &rec)
+	if err != nil {
+		return err
+	}
+	if n != int64(len(data)) {
+		return fmt.Errorf("%w: %d bytes after the record", ErrInvalidPayload, int64(len(data))-n)
+	}
+
+	err = unmarshalRecord(rec, rv.Elem())
+
+	var typeErr *UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		typeErr.Field = joinField(rv.Elem().Type().Name(), typeErr.Field)
+	}
+	return err
+}
+
+func joinField(parent, field string) string {
+	if field == "" {
+		return parent
+	}
+	return parent + "." + field
+}
+
+// An UnsupportedTypeError is returned by Marshal for a Go type that has no
+// payload to map to.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "tlv: unsupported type " + e.Type.String()
+}
+
+// An UnmarshalTypeError describes a payload that can't be stored in the Go
+// value it was decoded for.
+type UnmarshalTypeError struct {
+	Field string       // path to the struct field, such as "Service.Owner.Name"
+	Got   uint8        // type of the payload
+	Type  reflect.Type // type of the Go value
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("tlv: can't unmarshal type %d into Go value of type %s", e.Got, e.Type)
+	}
+	return fmt.Sprintf("tlv: can't unmarshal type %d into Go struct field %s of type %s", e.Got, e.Field, e.Type)
+}
+
+var (
+	payloadType = reflect.TypeOf((*Payload)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+)
+
+type fieldInfo struct {
+	index int
+	tag   uint16
+	name  string
+}
+
+var fieldCache sync.Map // map[reflect.Type][]fieldInfo
+
+// structFields returns the tagged fields of the struct type t.
+func structFields(t reflect.Type) ([]fieldInfo, error) {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]fieldInfo), nil
+	}
+
+	var (
+		fields []fieldInfo
+		seen   = make(map[uint16]string)
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("tlv")
+		if !ok || tag == "-" || !sf.IsExported() {
+			continue
+		}
+
+		n, err := strconv.ParseUint(tag, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("tlv: invalid tag %q on field %s.%s", tag, t.Name(), sf.Name)
+		}
+		if other, ok := seen[uint16(n)]; ok {
+			return nil, fmt.Errorf("tlv: fields %s and %s of %s have the same tag %d", other, sf.Name, t.Name(), n)
+		}
+		seen[uint16(n)] = sf.Name
+
+		fields = append(fields, fieldInfo{index: i, tag: uint16(n), name: sf.Name})
+	}
+
+	fieldCache.Store(t, fields)
+	return fields, nil
+}
+
+func marshalRecord(v reflect.Value) (Record, error) {
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	rec := make(Record, 0, len(fields))
+	for _, f := range fields {
+		p, err := toPayload(v.Field(f.index))
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			continue
+		}
+		rec = append(rec, Field{Tag: f.tag, Value: p})
+	}
+	return rec, nil
+}
+
+// asPayload returns v as a Payload if its type, or a pointer to it,
+// implements Payload.
+func asPayload(v reflect.Value) (Payload, bool) {
+	t := v.Type()
+	if t.Implements(payloadType) {
+		if (t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface) && v.IsNil() {
+			return nil, true
+		}
+		return v.Interface().(Payload), true
+	}
+	if reflect.PointerTo(t).Implements(payloadType) {
+		ptr := reflect.New(t)
+		ptr.Elem().Set(v)
+		return ptr.Interface().(Payload), true
+	}
+	return nil, false
+}
+
+// toPayload maps v to a payload, a nil payload means v should be left out.
+func toPayload(v reflect.Value) (Payload, error) {
+	if p, ok := asPayload(v); ok {
+		return p, nil
+	}
+	if v.Type() == timeType {
+		ts := Timestamp(v.Interface().(time.Time))
+		return &ts, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		m := Bool(v.Bool())
+		return &m, nil
+	case reflect.Int8:
+		m := Int8(v.Int())
+		return &m, nil
+	case reflect.Int16:
+		m := Int16(v.Int())
+		return &m, nil
+	case reflect.Int32:
+		m := Int32(v.Int())
+		return &m, nil
+	case reflect.Int64:
+		m := Int64(v.Int())
+		return &m, nil
+	case reflect.Int:
+		m := Varint(v.Int())
+		return &m, nil
+	case reflect.Uint8:
+		m := Uint8(v.Uint())
+		return &m, nil
+	case reflect.Uint16:
+		m := Uint16(v.Uint())
+		return &m, nil
+	case reflect.Uint32:
+		m := Uint32(v.Uint())
+		return &m, nil
+	case reflect.Uint64:
+		m := Uint64(v.Uint())
+		return &m, nil
+	case reflect.Uint:
+		m := Uvarint(v.Uint())
+		return &m, nil
+	case reflect.Float32, reflect.Float64:
+		m := Float64(v.Float())
+		return &m, nil
+	case reflect.String:
+		m := String(v.String())
+		return &m, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			m := Binary(v.Bytes())
+			return &m, nil
+		}
+		return toList(v)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, &UnsupportedTypeError{Type: v.Type()}
+		}
+		return toMap(v)
+	case reflect.Struct:
+		rec, err := marshalRecord(v)
+		if err != nil {
+			return nil, err
+		}
+		return &rec, nil
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return toPayload(v.Elem())
+	}
+
+	return nil, &UnsupportedTypeError{Type: v.Type()}
+}
+
+func toList(v reflect.Value) (Payload, error) {
+	elem, err := typeCode(v.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+
+	l := &List{Elem: elem, Items: make([]Payload, 0, v.Len())}
+	for i := 0; i < v.Len(); i++ {
+		p, err := toPayload(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, fmt.Errorf("tlv: nil item %d in %s", i, v.Type())
+		}
+		err = l.Append(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func toMap(v reflect.Value) (Payload, error) {
+	m := make(Map, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		p, err := toPayload(iter.Value())
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			continue
+		}
+		m[iter.Key().String()] = p
+	}
+	return &m, nil
+}
+
+// typeCode returns the type of payload values of the Go type t map to, which
+// Lists need to know even when they're empty. It works from t alone, so
+// types that contain themselves, such as trees, don't recurse forever.
+func typeCode(t reflect.Type) (uint8, error) {
+	// nil pointers have no payload of their own, use what they point to
+	for seen := map[reflect.Type]bool{}; t.Kind() == reflect.Pointer && !t.Implements(payloadType); t = t.Elem() {
+		if seen[t] {
+			return 0, &UnsupportedTypeError{Type: t}
+		}
+		seen[t] = true
+	}
+
+	switch {
+	case t.Implements(payloadType) && t.Kind() == reflect.Pointer:
+		return reflect.New(t.Elem()).Interface().(Payload).Type(), nil
+	case t.Implements(payloadType) && t.Kind() != reflect.Interface,
+		reflect.PointerTo(t).Implements(payloadType):
+		return reflect.New(t).Interface().(Payload).Type(), nil
+	case t == timeType:
+		return TimestampType, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return BoolType, nil
+	case reflect.Int8:
+		return Int8Type, nil
+	case reflect.Int16:
+		return Int16Type, nil
+	case reflect.Int32:
+		return Int32Type, nil
+	case reflect.Int64:
+		return Int64Type, nil
+	case reflect.Int:
+		return VarintType, nil
+	case reflect.Uint8:
+		return Uint8Type, nil
+	case reflect.Uint16:
+		return Uint16Type, nil
+	case reflect.Uint32:
+		return Uint32Type, nil
+	case reflect.Uint64:
+		return Uint64Type, nil
+	case reflect.Uint:
+		return UvarintType, nil
+	case reflect.Float32, reflect.Float64:
+		return Float64Type, nil
+	case reflect.String:
+		return StringType, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return BinaryType, nil
+		}
+		return ListType, nil
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return MapType, nil
+		}
+	case reflect.Struct:
+		_, err := structFields(t)
+		return RecordType, err
+	}
+	return 0, &UnsupportedTypeError{Type: t}
+}
+
+func unmarshalRecord(rec Record, v reflect.Value) error {
+	fields, err := structFields(v.Type())
+	if err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		p, ok := rec.Get(f.tag)
+		if !ok {
+			continue
+		}
+
+		err := fromPayload(p, v.Field(f.index))
+		if err != nil {
+			var typeErr *UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				typeErr.Field = joinField(f.name, typeErr.Field)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// fromPayload stores p in the settable value v.
+func fromPayload(p Payload, v reflect.Value) error {
+	mismatch := &UnmarshalTypeError{Got: p.Type(), Type: v.Type()}
+
+	t := v.Type()
+	switch {
+	case t == payloadType || (t.Kind() == reflect.Interface && t.NumMethod() == 0):
+		v.Set(reflect.ValueOf(p))
+		return nil
+	case t.Kind() == reflect.Pointer && t.Implements(payloadType):
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return unmarshalInto(p, v.Interface().(Payload), mismatch)
+	case reflect.PointerTo(t).Implements(payloadType):
+		return unmarshalInto(p, v.Addr().Interface().(Payload), mismatch)
+	case t == timeType:
+		ts, ok := p.(*Timestamp)
+		if !ok {
+			return mismatch
+		}
+		v.Set(reflect.ValueOf(ts.Time()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		b, ok := p.(*Bool)
+		if !ok {
+			return mismatch
+		}
+		v.SetBool(bool(*b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := intValue(p)
+		if !ok || v.OverflowInt(n) {
+			return mismatch
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := uintValue(p)
+		if !ok || v.OverflowUint(n) {
+			return mismatch
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := p.(*Float64)
+		if !ok {
+			return mismatch
+		}
+		v.SetFloat(float64(*f))
+	case reflect.String:
+		s, ok := p.(*String)
+		if !ok {
+			return mismatch
+		}
+		v.SetString(string(*s))
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			b, ok := p.(*Binary)
+			if !ok {
+				return mismatch
+			}
+			v.SetBytes(append([]byte(nil), *b...))
+			return nil
+		}
+		l, ok := p.(*List)
+		if !ok {
+			return mismatch
+		}
+		s := reflect.MakeSlice(t, len(l.Items), len(l.Items))
+		for i, item := range l.Items {
+			err := fromPayload(item, s.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+	case reflect.Map:
+		m, ok := p.(*Map)
+		if !ok || t.Key().Kind() != reflect.String {
+			return mismatch
+		}
+		mv := reflect.MakeMapWithSize(t, len(*m))
+		for k, item := range *m {
+			ev := reflect.New(t.Elem()).Elem()
+			err := fromPayload(item, ev)
+			if err != nil {
+				return err
+			}
+			mv.SetMapIndex(reflect.ValueOf(k).Convert(t.Key()), ev)
+		}
+		v.Set(mv)
+	case reflect.Struct:
+		rec, ok := p.(*Record)
+		if !ok {
+			return mismatch
+		}
+		return unmarshalRecord(*rec, v)
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return fromPayload(p, v.Elem())
+	default:
+		return mismatch
+	}
+	return nil
+}
+
+// unmarshalInto copies p into dst, a Payload field of the same type.
+func unmarshalInto(p, dst Payload, mismatch error) error {
+	if p.Type() != dst.Type() {
+		return mismatch
+	}
+	return dst.UnmarshalBinary(p.Bytes())
+}
+
+func intValue(p Payload) (int64, bool) {
+	switch m := p.(type) {
+	case *Int8:
+		return int64(*m), true
+	case *Int16:
+		return int64(*m), true
+	case *Int32:
+		return int64(*m), true
+	case *Int64:
+		return int64(*m), true
+	case *Varint:
+		return int64(*m), true
+	}
+	n, ok := uintValue(p)
+	if !ok || n > 1<<63-1 {
+		return 0, false
+	}
+	return int64(n), true
+}
+
+func uintValue(p Payload) (uint64, bool) {
+	switch m := p.(type) {
+	case *Uint8:
+		return uint64(*m), true
+	case *Uint16:
+		return uint64(*m), true
+	case *Uint32:
+		return uint64(*m), true
+	case *Uint64:
+		return uint64(*m), true
+	case *Uvarint:
+		return uint64(*m), true
+	case *Int8, *Int16, *Int32, *Int64, *Varint:
+		n, _ := intValue(p)
+		if n < 0 {
+			return 0, false
+		}
+		return uint64(n), true
+	}
+	return 0, false
+}
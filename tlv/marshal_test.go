@@ -0,0 +1,239 @@
+package tlv_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+type owner struct {
+	Name  string `tlv:"1"`
+	Admin bool   `tlv:"2"`
+}
+
+type service struct {
+	Name     string            `tlv:"1"`
+	Ports    []uint16          `tlv:"2"`
+	Labels   map[string]string `tlv:"3"`
+	Owner    *owner            `tlv:"4"`
+	Weight   float64           `tlv:"5"`
+	Replicas int               `tlv:"6"`
+	Offset   int64             `tlv:"7"`
+	Checksum []byte            `tlv:"8"`
+	Deployed time.Time         `tlv:"9"`
+	Backups  []owner           `tlv:"10"`
+	Extra    tlv.Payload       `tlv:"11"`
+	Note     tlv.String        `tlv:"12"`
+	Ignored  string            `tlv:"-"`
+	internal string
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	in := service{
+		Name:     "web",
+		Ports:    []uint16{80, 443},
+		Labels:   map[string]string{"env": "prod"},
+		Owner:    &owner{Name: "gopher", Admin: true},
+		Weight:   0.75,
+		Replicas: -3,
+		Offset:   1 << 40,
+		Checksum: []byte{0xde, 0xad, 0xbe, 0xef},
+		Deployed: time.Date(2023, 3, 7, 12, 0, 0, 0, time.UTC),
+		Backups:  []owner{{Name: "a"}, {Name: "b", Admin: true}},
+		Extra:    ptr(tlv.Int8(-1)),
+		Note:     "hello",
+		Ignored:  "not sent",
+		internal: "not sent",
+	}
+
+	data, err := tlv.Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out service
+	err = tlv.Unmarshal(data, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in.Ignored, in.internal = "", ""
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+}
+
+func TestMarshalProducesARecordFrame(t *testing.T) {
+	data, err := tlv.Marshal(owner{Name: "gopher"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := tlv.NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "{1:gopher 2:false}"; p.String() != want {
+		t.Errorf("expected %s, got %s", want, p)
+	}
+}
+
+func TestMarshalOmitsNilValues(t *testing.T) {
+	data, err := tlv.Marshal(service{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec tlv.Record
+	_, err = rec.ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []uint16{4, 11} {
+		if _, ok := rec.Get(tag); ok {
+			t.Errorf("expected nil field %d to be left out", tag)
+		}
+	}
+}
+
+type tree struct {
+	Name     string `tlv:"1"`
+	Children []tree `tlv:"2"`
+}
+
+func TestMarshalRecursiveTypes(t *testing.T) {
+	leaf := func(name string) tree { return tree{Name: name, Children: []tree{}} }
+	want := tree{Name: "root", Children: []tree{leaf("leaf"), {Name: "branch", Children: []tree{leaf("twig")}}}}
+
+	data, err := tlv.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got tree
+	err = tlv.Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestUnmarshalSkipsUnknownTags(t *testing.T) {
+	type ownerV2 struct {
+		Name  string   `tlv:"1"`
+		Admin bool     `tlv:"2"`
+		Teams []string `tlv:"3"`
+		Email string   `tlv:"4"`
+	}
+
+	data, err := tlv.Marshal(ownerV2{Name: "gopher", Teams: []string{"net"}, Email: "g@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got owner
+	err = tlv.Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "gopher" {
+		t.Errorf("expected gopher, got %q", got.Name)
+	}
+}
+
+func TestUnmarshalWidensIntegers(t *testing.T) {
+	type small struct {
+		N int8 `tlv:"1"`
+	}
+	type large struct {
+		N int64 `tlv:"1"`
+	}
+
+	data, err := tlv.Marshal(small{N: -7})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got large
+	err = tlv.Unmarshal(data, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.N != -7 {
+		t.Errorf("expected -7, got %d", got.N)
+	}
+
+	data, err = tlv.Marshal(large{N: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var overflow small
+	err = tlv.Unmarshal(data, &overflow)
+	var typeErr *tlv.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected an UnmarshalTypeError for 1000 in an int8, got %v", err)
+	}
+}
+
+func TestUnmarshalReportsMismatchedFields(t *testing.T) {
+	type wrongOwner struct {
+		Name int `tlv:"1"`
+	}
+	type wrongService struct {
+		Owner wrongOwner `tlv:"4"`
+	}
+
+	data, err := tlv.Marshal(service{Owner: &owner{Name: "gopher"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got wrongService
+	err = tlv.Unmarshal(data, &got)
+
+	var typeErr *tlv.UnmarshalTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected an UnmarshalTypeError, got %v", err)
+	}
+	if typeErr.Field != "wrongService.Owner.Name" || typeErr.Got != tlv.StringType {
+		t.Errorf("expected a String in wrongService.Owner.Name, got %v", err)
+	}
+}
+
+func TestMarshalRejectsUnsupportedTypes(t *testing.T) {
+	tests := []any{
+		struct {
+			C chan int `tlv:"1"`
+		}{},
+		struct {
+			M map[int]string `tlv:"1"`
+		}{M: map[int]string{1: "a"}},
+	}
+
+	for _, v := range tests {
+		_, err := tlv.Marshal(v)
+		var unsupported *tlv.UnsupportedTypeError
+		if !errors.As(err, &unsupported) {
+			t.Errorf("%T: expected an UnsupportedTypeError, got %v", v, err)
+		}
+	}
+
+	_, err := tlv.Marshal(struct {
+		A string `tlv:"1"`
+		B string `tlv:"1"`
+	}{})
+	if err == nil {
+		t.Error("expected an error for duplicate tags")
+	}
+
+	_, err = tlv.Marshal("not a struct")
+	if err == nil {
+		t.Error("expected an error marshaling a string")
+	}
+}
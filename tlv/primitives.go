@@ -0,0 +1,302 @@
+package tlv
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// checkSize returns an error if the body of a fixed width payload isn't
+// exactly sz bytes.
+func checkSize(p Payload, data []byte, sz int) error {
+	if len(data) != sz {
+		return fmt.Errorf("%w: %T needs %d bytes, got %d", ErrInvalidPayload, p, sz, len(data))
+	}
+	return nil
+}
+
+type Int8 int8
+
+func (m Int8) Bytes() []byte  { return m.appendBody(nil) }
+func (m Int8) String() string { return strconv.FormatInt(int64(m), 10) }
+func (m Int8) Type() uint8    { return Int8Type }
+
+func (m Int8) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Int8) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Int8) appendBody(b []byte) []byte { return append(b, byte(m)) }
+
+func (m *Int8) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 1); err != nil {
+		return err
+	}
+	*m = Int8(data[0])
+	return nil
+}
+
+type Int16 int16
+
+func (m Int16) Bytes() []byte  { return m.appendBody(nil) }
+func (m Int16) String() string { return strconv.FormatInt(int64(m), 10) }
+func (m Int16) Type() uint8    { return Int16Type }
+
+func (m Int16) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Int16) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Int16) appendBody(b []byte) []byte { return binary.BigEndian.AppendUint16(b, uint16(m)) }
+
+func (m *Int16) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 2); err != nil {
+		return err
+	}
+	*m = Int16(binary.BigEndian.Uint16(data))
+	return nil
+}
+
+type Int32 int32
+
+func (m Int32) Bytes() []byte  { return m.appendBody(nil) }
+func (m Int32) String() string { return strconv.FormatInt(int64(m), 10) }
+func (m Int32) Type() uint8    { return Int32Type }
+
+func (m Int32) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Int32) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Int32) appendBody(b []byte) []byte { return binary.BigEndian.AppendUint32(b, uint32(m)) }
+
+func (m *Int32) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 4); err != nil {
+		return err
+	}
+	*m = Int32(binary.BigEndian.Uint32(data))
+	return nil
+}
+
+type Int64 int64
+
+func (m Int64) Bytes() []byte  { return m.appendBody(nil) }
+func (m Int64) String() string { return strconv.FormatInt(int64(m), 10) }
+func (m Int64) Type() uint8    { return Int64Type }
+
+func (m Int64) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Int64) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Int64) appendBody(b []byte) []byte { return binary.BigEndian.AppendUint64(b, uint64(m)) }
+
+func (m *Int64) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 8); err != nil {
+		return err
+	}
+	*m = Int64(binary.BigEndian.Uint64(data))
+	return nil
+}
+
+type Uint8 uint8
+
+func (m Uint8) Bytes() []byte  { return m.appendBody(nil) }
+func (m Uint8) String() string { return strconv.FormatUint(uint64(m), 10) }
+func (m Uint8) Type() uint8    { return Uint8Type }
+
+func (m Uint8) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Uint8) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Uint8) appendBody(b []byte) []byte { return append(b, byte(m)) }
+
+func (m *Uint8) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 1); err != nil {
+		return err
+	}
+	*m = Uint8(data[0])
+	return nil
+}
+
+type Uint16 uint16
+
+func (m Uint16) Bytes() []byte  { return m.appendBody(nil) }
+func (m Uint16) String() string { return strconv.FormatUint(uint64(m), 10) }
+func (m Uint16) Type() uint8    { return Uint16Type }
+
+func (m Uint16) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Uint16) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Uint16) appendBody(b []byte) []byte { return binary.BigEndian.AppendUint16(b, uint16(m)) }
+
+func (m *Uint16) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 2); err != nil {
+		return err
+	}
+	*m = Uint16(binary.BigEndian.Uint16(data))
+	return nil
+}
+
+type Uint32 uint32
+
+func (m Uint32) Bytes() []byte  { return m.appendBody(nil) }
+func (m Uint32) String() string { return strconv.FormatUint(uint64(m), 10) }
+func (m Uint32) Type() uint8    { return Uint32Type }
+
+func (m Uint32) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Uint32) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Uint32) appendBody(b []byte) []byte { return binary.BigEndian.AppendUint32(b, uint32(m)) }
+
+func (m *Uint32) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 4); err != nil {
+		return err
+	}
+	*m = Uint32(binary.BigEndian.Uint32(data))
+	return nil
+}
+
+type Uint64 uint64
+
+func (m Uint64) Bytes() []byte  { return m.appendBody(nil) }
+func (m Uint64) String() string { return strconv.FormatUint(uint64(m), 10) }
+func (m Uint64) Type() uint8    { return Uint64Type }
+
+func (m Uint64) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Uint64) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Uint64) appendBody(b []byte) []byte { return binary.BigEndian.AppendUint64(b, uint64(m)) }
+
+func (m *Uint64) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 8); err != nil {
+		return err
+	}
+	*m = Uint64(binary.BigEndian.Uint64(data))
+	return nil
+}
+
+// Varint is a signed integer encoded in as few bytes as its value needs,
+// see encoding/binary.AppendVarint.
+type Varint int64
+
+func (m Varint) Bytes() []byte  { return m.appendBody(nil) }
+func (m Varint) String() string { return strconv.FormatInt(int64(m), 10) }
+func (m Varint) Type() uint8    { return VarintType }
+
+func (m Varint) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Varint) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Varint) appendBody(b []byte) []byte { return binary.AppendVarint(b, int64(m)) }
+
+func (m *Varint) UnmarshalBinary(data []byte) error {
+	v, n := binary.Varint(data)
+	if n <= 0 || n != len(data) {
+		return fmt.Errorf("%w: malformed Varint", ErrInvalidPayload)
+	}
+	*m = Varint(v)
+	return nil
+}
+
+// Uvarint is an unsigned integer encoded in as few bytes as its value needs,
+// see encoding/binary.AppendUvarint.
+type Uvarint uint64
+
+func (m Uvarint) Bytes() []byte  { return m.appendBody(nil) }
+func (m Uvarint) String() string { return strconv.FormatUint(uint64(m), 10) }
+func (m Uvarint) Type() uint8    { return UvarintType }
+
+func (m Uvarint) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Uvarint) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Uvarint) appendBody(b []byte) []byte { return binary.AppendUvarint(b, uint64(m)) }
+
+func (m *Uvarint) UnmarshalBinary(data []byte) error {
+	v, n := binary.Uvarint(data)
+	if n <= 0 || n != len(data) {
+		return fmt.Errorf("%w: malformed Uvarint", ErrInvalidPayload)
+	}
+	*m = Uvarint(v)
+	return nil
+}
+
+// Float64 is an IEEE 754 double precision number.
+type Float64 float64
+
+func (m Float64) Bytes() []byte  { return m.appendBody(nil) }
+func (m Float64) String() string { return strconv.FormatFloat(float64(m), 'g', -1, 64) }
+func (m Float64) Type() uint8    { return Float64Type }
+
+func (m Float64) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Float64) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Float64) appendBody(b []byte) []byte {
+	return binary.BigEndian.AppendUint64(b, math.Float64bits(float64(m)))
+}
+
+func (m *Float64) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 8); err != nil {
+		return err
+	}
+	*m = Float64(math.Float64frombits(binary.BigEndian.Uint64(data)))
+	return nil
+}
+
+// Bool is encoded as a single byte, 1 for true and 0 for false.
+type Bool bool
+
+func (m Bool) Bytes() []byte  { return m.appendBody(nil) }
+func (m Bool) String() string { return strconv.FormatBool(bool(m)) }
+func (m Bool) Type() uint8    { return BoolType }
+
+func (m Bool) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Bool) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Bool) appendBody(b []byte) []byte {
+	if m {
+		return append(b, 1)
+	}
+	return append(b, 0)
+}
+
+func (m *Bool) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 1); err != nil {
+		return err
+	}
+	switch data[0] {
+	case 0:
+		*m = false
+	case 1:
+		*m = true
+	default:
+		return fmt.Errorf("%w: Bool must be 0 or 1, got %d", ErrInvalidPayload, data[0])
+	}
+	return nil
+}
+
+// Timestamp is an instant in time encoded as 8 bytes of seconds since the
+// Unix epoch followed by 4 bytes of nanoseconds. The location isn't encoded,
+// decoded timestamps are in UTC.
+type Timestamp time.Time
+
+func (m Timestamp) Time() time.Time { return time.Time(m) }
+
+func (m Timestamp) Bytes() []byte  { return m.appendBody(make([]byte, 0, 12)) }
+func (m Timestamp) String() string { return time.Time(m).Format(time.RFC3339Nano) }
+func (m Timestamp) Type() uint8    { return TimestampType }
+
+func (m Timestamp) WriteTo(w io.Writer) (int64, error)   { return writeAppended(w, m) }
+func (m *Timestamp) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m Timestamp) appendBody(b []byte) []byte {
+	t := time.Time(m)
+	b = binary.BigEndian.AppendUint64(b, uint64(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+func (m *Timestamp) UnmarshalBinary(data []byte) error {
+	if err := checkSize(m, data, 12); err != nil {
+		return err
+	}
+	sec := int64(binary.BigEndian.Uint64(data))
+	nsec := binary.BigEndian.Uint32(data[8:])
+	if nsec >= uint32(time.Second) {
+		return fmt.Errorf("%w: Timestamp nanoseconds out of range", ErrInvalidPayload)
+	}
+	*m = Timestamp(time.Unix(sec, int64(nsec)).UTC())
+	return nil
+}
@@ -0,0 +1,115 @@
+package tlv_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestPrimitivesRoundTrip(t *testing.T) {
+	payloads := []tlv.Payload{
+		ptr(tlv.Int8(math.MinInt8)),
+		ptr(tlv.Int8(math.MaxInt8)),
+		ptr(tlv.Int16(math.MinInt16)),
+		ptr(tlv.Int32(-42)),
+		ptr(tlv.Int64(math.MinInt64)),
+		ptr(tlv.Int64(math.MaxInt64)),
+		ptr(tlv.Uint8(math.MaxUint8)),
+		ptr(tlv.Uint16(math.MaxUint16)),
+		ptr(tlv.Uint32(math.MaxUint32)),
+		ptr(tlv.Uint64(math.MaxUint64)),
+		ptr(tlv.Varint(0)),
+		ptr(tlv.Varint(-300)),
+		ptr(tlv.Varint(math.MinInt64)),
+		ptr(tlv.Uvarint(127)),
+		ptr(tlv.Uvarint(math.MaxUint64)),
+		ptr(tlv.Float64(math.Pi)),
+		ptr(tlv.Float64(math.Inf(-1))),
+		ptr(tlv.Bool(true)),
+		ptr(tlv.Bool(false)),
+		ptr(tlv.Timestamp(time.Date(2023, 3, 7, 12, 30, 15, 123456789, time.UTC))),
+		ptr(tlv.Timestamp(time.Date(1900, 1, 1, 0, 0, 0, 1, time.UTC))),
+	}
+
+	var buf bytes.Buffer
+	enc := tlv.NewEncoder(&buf)
+	for _, p := range payloads {
+		err := enc.Encode(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := tlv.NewDecoder(&buf)
+	for _, want := range payloads {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Type() != want.Type() || got.String() != want.String() {
+			t.Errorf("expected %T %s, got %T %s", want, want, got, got)
+		}
+	}
+}
+
+func TestVarintsUseFewBytesForSmallValues(t *testing.T) {
+	if n := len(tlv.Varint(-1).Bytes()); n != 1 {
+		t.Errorf("expected Varint(-1) to take 1 byte, got %d", n)
+	}
+	if n := len(tlv.Uvarint(300).Bytes()); n != 2 {
+		t.Errorf("expected Uvarint(300) to take 2 bytes, got %d", n)
+	}
+}
+
+func TestTimestampDecodesToUTC(t *testing.T) {
+	loc := time.FixedZone("EST", -5*60*60)
+	want := time.Date(2023, 3, 7, 7, 30, 0, 0, loc)
+
+	var got tlv.Timestamp
+	err := got.UnmarshalBinary(tlv.Timestamp(want).Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time().Equal(want) || got.Time().Location() != time.UTC {
+		t.Errorf("expected %s in UTC, got %s", want, got)
+	}
+}
+
+func TestPrimitivesRejectMalformedBodies(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload tlv.Payload
+		body    []byte
+	}{
+		{name: "short Int32", payload: new(tlv.Int32), body: []byte{1, 2, 3}},
+		{name: "long Uint16", payload: new(tlv.Uint16), body: []byte{1, 2, 3}},
+		{name: "empty Float64", payload: new(tlv.Float64), body: nil},
+		{name: "Bool out of range", payload: new(tlv.Bool), body: []byte{2}},
+		{name: "truncated Varint", payload: new(tlv.Varint), body: []byte{0x80}},
+		{name: "Uvarint with trailing bytes", payload: new(tlv.Uvarint), body: []byte{1, 2}},
+		{name: "Timestamp nanoseconds out of range", payload: new(tlv.Timestamp), body: []byte{0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff}},
+	}
+
+	for _, tt := range tests {
+		err := tt.payload.UnmarshalBinary(tt.body)
+		if !errors.Is(err, tlv.ErrInvalidPayload) {
+			t.Errorf("%s: expected ErrInvalidPayload, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestReadFromRejectsOtherTypes(t *testing.T) {
+	i := tlv.Int32(7)
+
+	var u tlv.Uint32
+	_, err := u.ReadFrom(bytes.NewReader(encode(t, &i)))
+	if !errors.Is(err, tlv.ErrInvalidPayload) {
+		t.Errorf("expected ErrInvalidPayload, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package tlv
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Types below MinUserType are reserved for payloads defined by this package,
+// type 0 is never valid.
+const MinUserType uint8 = 64
+
+var (
+	ErrUnknownType   = errors.New("unknown type")
+	ErrDuplicateType = errors.New("type already registered")
+	ErrReservedType  = errors.New("type is reserved")
+)
+
+// Registry maps type codes to factories for the payloads they decode to.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[uint8]func() Payload
+}
+
+// DefaultRegistry is used by Register and by decoding that isn't given a
+// registry of its own.
+var DefaultRegistry = NewRegistry()
+
+// builtins are the payload types defined by this package.
+var builtins = map[uint8]func() Payload{
+	BinaryType:     func() Payload { return new(Binary) },
+	StringType:     func() Payload { return new(String) },
+	Int8Type:       func() Payload { return new(Int8) },
+	Int16Type:      func() Payload { return new(Int16) },
+	Int32Type:      func() Payload { return new(Int32) },
+	Int64Type:      func() Payload { return new(Int64) },
+	Uint8Type:      func() Payload { return new(Uint8) },
+	Uint16Type:     func() Payload { return new(Uint16) },
+	Uint32Type:     func() Payload { return new(Uint32) },
+	Uint64Type:     func() Payload { return new(Uint64) },
+	VarintType:     func() Payload { return new(Varint) },
+	UvarintType:    func() Payload { return new(Uvarint) },
+	Float64Type:    func() Payload { return new(Float64) },
+	BoolType:       func() Payload { return new(Bool) },
+	TimestampType:  func() Payload { return new(Timestamp) },
+	ListType:       func() Payload { return new(List) },
+	MapType:        func() Payload { return new(Map) },
+	RecordType:     func() Payload { return new(Record) },
+	CallType:       func() Payload { return new(Call) },
+	ReplyType:      func() Payload { return new(Reply) },
+	ErrorType:      func() Payload { return new(Error) },
+	CompressedType: func() Payload { return new(Compressed) },
+	ExtendedType:   func() Payload { return new(Extended) },
+}
+
+// NewRegistry returns a registry holding the built-in payload types.
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[uint8]func() Payload, len(builtins))}
+	for typ, factory := range builtins {
+		r.factories[typ] = factory
+	}
+	return r
+}
+
+// Register adds a payload type to the DefaultRegistry.
+func Register(typ uint8, factory func() Payload) error {
+	return DefaultRegistry.Register(typ, factory)
+}
+
+// Register makes factory responsible for creating the payload that frames of
+// type typ decode to. The type must be at least MinUserType and must not
+// already be registered.
+func (r *Registry) Register(typ uint8, factory func() Payload) error {
+	if typ < MinUserType {
+		return fmt.Errorf("%w: %d is below %d", ErrReservedType, typ, MinUserType)
+	}
+	if factory == nil {
+		return errors.New("nil factory")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.factories[typ]; ok {
+		return fmt.Errorf("%w: %d", ErrDuplicateType, typ)
+	}
+	r.factories[typ] = factory
+
+	return nil
+}
+
+// New returns an empty payload for typ, ready to be read into.
+func (r *Registry) New(typ uint8) (Payload, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[typ]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownType, typ)
+	}
+	return factory(), nil
+}
@@ -0,0 +1,143 @@
+package tlv_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+const pointType uint8 = tlv.MinUserType
+
+// point is a payload a user of the package might define, an x and y
+// coordinate packed into 8 bytes.
+type point struct{ X, Y int32 }
+
+func (p *point) Bytes() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(p.X))
+	binary.BigEndian.PutUint32(b[4:], uint32(p.Y))
+	return b
+}
+
+func (p *point) String() string { return fmt.Sprintf("(%d, %d)", p.X, p.Y) }
+func (p *point) Type() uint8    { return pointType }
+
+func (p *point) WriteTo(w io.Writer) (int64, error)  { return tlv.WriteFrame(w, p) }
+func (p *point) ReadFrom(r io.Reader) (int64, error) { return tlv.ReadFrame(r, p) }
+
+func (p *point) UnmarshalBinary(data []byte) error {
+	if len(data) != 8 {
+		return errors.New("invalid point")
+	}
+	p.X = int32(binary.BigEndian.Uint32(data))
+	p.Y = int32(binary.BigEndian.Uint32(data[4:]))
+	return nil
+}
+
+func TestDecoderUsesRegisteredTypes(t *testing.T) {
+	reg := tlv.NewRegistry()
+	err := reg.Register(pointType, func() tlv.Payload { return new(point) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := tlv.String("origin")
+	p := point{X: -3, Y: 7}
+
+	dec := tlv.NewDecoder(bytes.NewReader(encode(t, &s, &p)), tlv.WithRegistry(reg))
+
+	got, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != "origin" {
+		t.Errorf("expected %q, got %q", "origin", got)
+	}
+
+	got, err = dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotP, ok := got.(*point); !ok || *gotP != p {
+		t.Errorf("expected %+v, got %+v", p, got)
+	}
+
+	_, err = dec.Decode()
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecoderUsesRegisteredTypesWhenNested(t *testing.T) {
+	reg := tlv.NewRegistry()
+	err := reg.Register(pointType, func() tlv.Payload { return new(point) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &point{X: 4, Y: 5}
+	list, err := tlv.NewList(pointType, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []tlv.Payload{
+		list,
+		&tlv.Map{"p": p},
+		&tlv.Record{{Tag: 1, Value: p}},
+	} {
+		got, err := tlv.NewDecoder(bytes.NewReader(encode(t, want)), tlv.WithRegistry(reg)).Decode()
+		if err != nil {
+			t.Fatalf("%T: %v", want, err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+
+	// the types accepted apply inside containers too
+	dec := tlv.NewDecoder(bytes.NewReader(encode(t, &tlv.Record{{Tag: 1, Value: p}})),
+		tlv.WithRegistry(reg), tlv.WithTypes(tlv.NewTypeSet(tlv.RecordType)))
+	if _, err := dec.Decode(); !errors.Is(err, tlv.ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType for a nested type, got %v", err)
+	}
+}
+
+func TestDecoderRejectsUnknownTypes(t *testing.T) {
+	p := point{X: 1, Y: 2}
+
+	// the type isn't in the default registry
+	_, err := tlv.NewDecoder(bytes.NewReader(encode(t, &p))).Decode()
+	if !errors.Is(err, tlv.ErrUnknownType) {
+		t.Errorf("expected ErrUnknownType, got %v", err)
+	}
+}
+
+func TestRegisterRejectsReservedAndDuplicateTypes(t *testing.T) {
+	reg := tlv.NewRegistry()
+	factory := func() tlv.Payload { return new(point) }
+
+	err := reg.Register(tlv.StringType, factory)
+	if !errors.Is(err, tlv.ErrReservedType) {
+		t.Errorf("expected ErrReservedType, got %v", err)
+	}
+
+	err = reg.Register(tlv.MinUserType-1, factory)
+	if !errors.Is(err, tlv.ErrReservedType) {
+		t.Errorf("expected ErrReservedType, got %v", err)
+	}
+
+	err = reg.Register(pointType, factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = reg.Register(pointType, factory)
+	if !errors.Is(err, tlv.ErrDuplicateType) {
+		t.Errorf("expected ErrDuplicateType, got %v", err)
+	}
+}
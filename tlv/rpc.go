@@ -0,0 +1,360 @@
+package tlv
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// Codes for the errors an RPCHandler sends back.
+const (
+	CodeInternal      uint16 = iota + 1 // the method returned an error
+	CodeUnknownMethod                   // no method is registered under the name
+	CodeBadRequest                      // the payload wasn't a Call
+)
+
+var ErrClientClosed = errors.New("tlv: client closed")
+
+// Call is a request to run a method, sent by an RPCClient. ID is chosen by the
+// client and is echoed in the Reply. It is encoded as a uvarint ID, a String
+// frame for the method and, if there is one, a frame for the body.
+type Call struct {
+	ID     uint64
+	Method string
+	Body   Payload
+}
+
+func (m *Call) Bytes() []byte {
+	method := String(m.Method)
+	b := binary.AppendUvarint(nil, m.ID)
+	b = AppendFrame(b, &method)
+	if m.Body != nil {
+		b = AppendFrame(b, m.Body)
+	}
+	return b
+}
+
+func (m *Call) String() string { return fmt.Sprintf("call(%d) %s %v", m.ID, m.Method, m.Body) }
+func (m *Call) Type() uint8    { return CallType }
+
+func (m *Call) validate() error { return validateAll(m.Body) }
+
+func (m *Call) WriteTo(w io.Writer) (int64, error)  { return WriteFrame(w, m) }
+func (m *Call) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *Call) UnmarshalBinary(data []byte) error { return m.unmarshalAt(data, topLevel()) }
+
+func (m *Call) unmarshalAt(data []byte, nest nesting) error {
+	id, n := binary.Uvarint(data)
+	if n <= 0 {
+		return fmt.Errorf("%w: malformed Call ID", ErrInvalidPayload)
+	}
+
+	typ, method, rest, err := NextFrame(data[n:])
+	if err != nil {
+		return err
+	}
+	if typ != StringType {
+		return fmt.Errorf("%w: Call method must be a String, got type %d", ErrInvalidPayload, typ)
+	}
+
+	m.ID, m.Method, m.Body = id, string(method), nil
+
+	if len(rest) == 0 {
+		return nil
+	}
+
+	m.Body, rest, err = decodeFrame(rest, nest.inside())
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%w: %d bytes after the Call body", ErrInvalidPayload, len(rest))
+	}
+	return nil
+}
+
+// Reply is the result of a Call, with the ID of the call it answers. A failed
+// call has an *Error body. It is encoded as a uvarint ID and, if there is
+// one, a frame for the body.
+type Reply struct {
+	ID   uint64
+	Body Payload
+}
+
+func (m *Reply) Bytes() []byte {
+	b := binary.AppendUvarint(nil, m.ID)
+	if m.Body != nil {
+		b = AppendFrame(b, m.Body)
+	}
+	return b
+}
+
+func (m *Reply) String() string { return fmt.Sprintf("reply(%d) %v", m.ID, m.Body) }
+func (m *Reply) Type() uint8    { return ReplyType }
+
+func (m *Reply) validate() error { return validateAll(m.Body) }
+
+func (m *Reply) WriteTo(w io.Writer) (int64, error)  { return WriteFrame(w, m) }
+func (m *Reply) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *Reply) UnmarshalBinary(data []byte) error { return m.unmarshalAt(data, topLevel()) }
+
+func (m *Reply) unmarshalAt(data []byte, nest nesting) error {
+	id, n := binary.Uvarint(data)
+	if n <= 0 {
+		return fmt.Errorf("%w: malformed Reply ID", ErrInvalidPayload)
+	}
+
+	m.ID, m.Body = id, nil
+
+	rest := data[n:]
+	if len(rest) == 0 {
+		return nil
+	}
+
+	var err error
+	m.Body, rest, err = decodeFrame(rest, nest.inside())
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("%w: %d bytes after the Reply body", ErrInvalidPayload, len(rest))
+	}
+	return nil
+}
+
+// Error is a failed call, sent back in place of the result. It is both a
+// Payload and an error, RPCClient.Call returns it as is. It is encoded as a
+// 2-byte code followed by the message.
+type Error struct {
+	Code    uint16
+	Message string
+}
+
+func (m *Error) Bytes() []byte {
+	return append(binary.BigEndian.AppendUint16(nil, m.Code), m.Message...)
+}
+
+func (m *Error) Error() string  { return fmt.Sprintf("tlv: remote error %d: %s", m.Code, m.Message) }
+func (m *Error) String() string { return m.Error() }
+func (m *Error) Type() uint8    { return ErrorType }
+
+func (m *Error) WriteTo(w io.Writer) (int64, error)  { return WriteFrame(w, m) }
+func (m *Error) ReadFrom(r io.Reader) (int64, error) { return ReadFrame(r, m) }
+
+func (m *Error) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("%w: Error needs at least 2 bytes, got %d", ErrInvalidPayload, len(data))
+	}
+	m.Code = binary.BigEndian.Uint16(data)
+	m.Message = string(data[2:])
+	return nil
+}
+
+// MethodFunc runs a method, returning the body of the reply. A returned
+// *Error is sent as is, any other error is sent with CodeInternal.
+type MethodFunc func(body Payload) (Payload, error)
+
+// RPCHandler is a Handler that dispatches Calls to the method registered
+// under their name. Each call runs on its own goroutine, so a slow method
+// doesn't hold up the others outstanding on a connection, and replies go out
+// in the order the calls finish.
+type RPCHandler struct {
+	mu      sync.RWMutex
+	methods map[string]MethodFunc
+}
+
+func NewRPCHandler() *RPCHandler {
+	return &RPCHandler{methods: make(map[string]MethodFunc)}
+}
+
+// Register makes fn responsible for calls to the method name.
+func (h *RPCHandler) Register(name string, fn MethodFunc) error {
+	if fn == nil {
+		return errors.New("nil method")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.methods[name]; ok {
+		return fmt.Errorf("method %q already registered", name)
+	}
+	h.methods[name] = fn
+	return nil
+}
+
+func (h *RPCHandler) ServeTLV(w ResponseWriter, p Payload) {
+	call, ok := p.(*Call)
+	if !ok {
+		_ = w.Write(&Reply{Body: &Error{Code: CodeBadRequest, Message: fmt.Sprintf("expected a Call, got type %d", p.Type())}})
+		return
+	}
+
+	if a, ok := w.(asyncWriter); ok {
+		a.async(func() { h.serveCall(w, call) })
+		return
+	}
+	go h.serveCall(w, call)
+}
+
+func (h *RPCHandler) serveCall(w ResponseWriter, call *Call) {
+	h.mu.RLock()
+	fn, ok := h.methods[call.Method]
+	h.mu.RUnlock()
+
+	if !ok {
+		_ = w.Write(&Reply{ID: call.ID, Body: &Error{Code: CodeUnknownMethod, Message: "unknown method " + call.Method}})
+		return
+	}
+
+	body, err := fn(call.Body)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeInternal, Message: err.Error()}
+		}
+		body = rpcErr
+	}
+
+	_ = w.Write(&Reply{ID: call.ID, Body: body})
+}
+
+// RPCClient makes calls over a single connection. It is safe to use from
+// multiple goroutines, calls are matched to their replies by ID so many can
+// be outstanding at once.
+type RPCClient struct {
+	conn net.Conn
+
+	encMu sync.Mutex
+	enc   *Encoder
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan *Reply
+	err     error // set once the connection fails or is closed
+
+	done chan struct{}
+}
+
+// NewRPCClient returns a client making calls over conn, which it takes
+// ownership of.
+func NewRPCClient(conn net.Conn) *RPCClient {
+	c := &RPCClient{
+		conn:    conn,
+		enc:     NewEncoder(conn),
+		pending: make(map[uint64]chan *Reply),
+		done:    make(chan struct{}),
+	}
+	go c.readReplies()
+	return c
+}
+
+// DialRPC connects to the RPC server at addr.
+func DialRPC(addr string) (*RPCClient, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewRPCClient(conn), nil
+}
+
+// Call runs method on the server with the given body, which may be nil, and
+// returns the body of the reply. A failed call returns an *Error.
+func (c *RPCClient) Call(ctx context.Context, method string, body Payload) (Payload, error) {
+	replies := make(chan *Reply, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = replies
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	c.encMu.Lock()
+	err := c.enc.Encode(&Call{ID: id, Method: method, Body: body})
+	c.encMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply := <-replies:
+		if rpcErr, ok := reply.Body.(*Error); ok {
+			return nil, rpcErr
+		}
+		return reply.Body, nil
+	case <-c.done:
+		return nil, c.closeErr()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the connection, failing any outstanding calls.
+func (c *RPCClient) Close() error {
+	c.fail(ErrClientClosed)
+	return c.conn.Close()
+}
+
+func (c *RPCClient) readReplies() {
+	dec := NewDecoder(c.conn)
+	for {
+		p, err := dec.Decode()
+		if err != nil {
+			if errors.Is(err, ErrUnknownType) {
+				continue
+			}
+			c.fail(err)
+			return
+		}
+
+		reply, ok := p.(*Reply)
+		if !ok {
+			continue
+		}
+
+		// a call only takes one reply, a duplicate or late one finds
+		// nothing waiting for it
+		c.mu.Lock()
+		replies, ok := c.pending[reply.ID]
+		delete(c.pending, reply.ID)
+		c.mu.Unlock()
+
+		if ok {
+			replies <- reply
+		}
+	}
+}
+
+// fail records the first error that stops the client and wakes up any
+// outstanding calls.
+func (c *RPCClient) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.done)
+}
+
+func (c *RPCClient) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
@@ -0,0 +1,246 @@
+package tlv_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func newRPCClient(t *testing.T, h *tlv.RPCHandler) *tlv.RPCClient {
+	t.Helper()
+
+	s := newServer(t, h)
+	c, err := tlv.DialRPC(s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestRPCConcurrentCallsOverOneConnection(t *testing.T) {
+	h := tlv.NewRPCHandler()
+	err := h.Register("double", func(body tlv.Payload) (tlv.Payload, error) {
+		n, ok := body.(*tlv.Int64)
+		if !ok {
+			return nil, &tlv.Error{Code: tlv.CodeBadRequest, Message: "expected an Int64"}
+		}
+		return ptr(*n * 2), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newRPCClient(t, h)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			got, err := c.Call(context.Background(), "double", ptr(tlv.Int64(i)))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if n := *got.(*tlv.Int64); n != tlv.Int64(i*2) {
+				t.Errorf("expected %d, got %d", i*2, n)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRPCRepliesOutOfOrder(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	h := tlv.NewRPCHandler()
+	_ = h.Register("slow", func(tlv.Payload) (tlv.Payload, error) {
+		close(started)
+		<-release
+		return ptr(tlv.String("slow")), nil
+	})
+	_ = h.Register("fast", func(tlv.Payload) (tlv.Payload, error) {
+		return ptr(tlv.String("fast")), nil
+	})
+
+	c := newRPCClient(t, h)
+
+	slow := make(chan error, 1)
+	go func() {
+		_, err := c.Call(context.Background(), "slow", nil)
+		slow <- err
+	}()
+	<-started
+
+	// the fast call is answered while the slow one is still running
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := c.Call(ctx, "fast", nil)
+	if err != nil {
+		t.Fatalf("expected the fast call not to wait on the slow one, got %v", err)
+	}
+	if got.String() != "fast" {
+		t.Errorf("expected fast, got %q", got)
+	}
+	select {
+	case err := <-slow:
+		t.Fatalf("expected the slow call to still be running, got %v", err)
+	default:
+	}
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRPCClientIgnoresDuplicateReplies(t *testing.T) {
+	server, client := net.Pipe()
+	c := tlv.NewRPCClient(client)
+	defer c.Close()
+
+	// a server answering every call more than once
+	go func() {
+		dec, enc := tlv.NewDecoder(server), tlv.NewEncoder(server)
+		for {
+			p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			reply := &tlv.Reply{ID: p.(*tlv.Call).ID, Body: ptr(tlv.String("ok"))}
+			for i := 0; i < 3; i++ {
+				_ = enc.Encode(reply)
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		_, err := c.Call(ctx, "repeat", nil)
+		cancel()
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+}
+
+func TestRPCErrorsTravelBack(t *testing.T) {
+	h := tlv.NewRPCHandler()
+	_ = h.Register("fail", func(tlv.Payload) (tlv.Payload, error) {
+		return nil, fmt.Errorf("disk on fire")
+	})
+	_ = h.Register("reject", func(tlv.Payload) (tlv.Payload, error) {
+		return nil, &tlv.Error{Code: 42, Message: "no"}
+	})
+
+	c := newRPCClient(t, h)
+
+	tests := []struct {
+		method string
+		code   uint16
+	}{
+		{"fail", tlv.CodeInternal},
+		{"reject", 42},
+		{"missing", tlv.CodeUnknownMethod},
+	}
+	for _, tc := range tests {
+		_, err := c.Call(context.Background(), tc.method, nil)
+
+		var rpcErr *tlv.Error
+		if !errors.As(err, &rpcErr) {
+			t.Errorf("%s: expected a *tlv.Error, got %v", tc.method, err)
+			continue
+		}
+		if rpcErr.Code != tc.code {
+			t.Errorf("%s: expected code %d, got %d", tc.method, tc.code, rpcErr.Code)
+		}
+	}
+}
+
+func TestRPCCallStopsWaitingWhenContextIsDone(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	h := tlv.NewRPCHandler()
+	_ = h.Register("slow", func(tlv.Payload) (tlv.Payload, error) {
+		<-release
+		return nil, nil
+	})
+
+	c := newRPCClient(t, h)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err := c.Call(ctx, "slow", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestRPCCloseFailsOutstandingCalls(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	started := make(chan struct{})
+	h := tlv.NewRPCHandler()
+	_ = h.Register("slow", func(tlv.Payload) (tlv.Payload, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+
+	c := newRPCClient(t, h)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.Call(context.Background(), "slow", nil)
+		errs <- err
+	}()
+	<-started
+
+	_ = c.Close()
+	if err := <-errs; !errors.Is(err, tlv.ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+
+	_, err := c.Call(context.Background(), "slow", nil)
+	if !errors.Is(err, tlv.ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed after Close, got %v", err)
+	}
+}
+
+func TestRPCHandlerRejectsDuplicateMethods(t *testing.T) {
+	h := tlv.NewRPCHandler()
+	fn := func(tlv.Payload) (tlv.Payload, error) { return nil, nil }
+
+	if err := h.Register("m", fn); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Register("m", fn); err == nil {
+		t.Error("expected an error registering a method twice")
+	}
+}
+
+func TestCallRoundTrip(t *testing.T) {
+	call := &tlv.Call{ID: 1 << 40, Method: "lookup", Body: &tlv.Record{{Tag: 1, Value: ptr(tlv.String("gopher"))}}}
+
+	got, err := decodeOne(t, call)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := got.(*tlv.Call)
+	if !ok {
+		t.Fatalf("expected *tlv.Call, got %T", got)
+	}
+	if c.ID != call.ID || c.Method != call.Method || c.Body.String() != call.Body.String() {
+		t.Errorf("expected %s, got %s", call, c)
+	}
+}
@@ -1,48 +1,421 @@
 package tlv
 
 import (
-	"log"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
 	"net"
 	"os"
+	"sync"
+	"time"
 )
 
+// ErrServerClosed is returned by Server.Run after Shutdown is called.
+var ErrServerClosed = errors.New("tlv: server closed")
+
+// Handler responds to the payloads decoded from a connection. ServeTLV is
+// called for each payload in the order they arrive, payloads from different
+// connections are handled concurrently.
+type Handler interface {
+	ServeTLV(w ResponseWriter, p Payload)
+}
+
+// HandlerFunc lets an ordinary function be used as a Handler.
+type HandlerFunc func(w ResponseWriter, p Payload)
+
+func (f HandlerFunc) ServeTLV(w ResponseWriter, p Payload) { f(w, p) }
+
+// ResponseWriter sends payloads back to the peer a payload came from. It is
+// safe to use from multiple goroutines.
+type ResponseWriter interface {
+	Write(p Payload) error
+	RemoteAddr() net.Addr
+}
+
+type responseWriter struct {
+	mu      sync.Mutex
+	enc     *Encoder
+	remote  net.Addr
+	pending sync.WaitGroup // handlers still running in the background
+}
+
+func (w *responseWriter) Write(p Payload) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(p)
+}
+
+func (w *responseWriter) RemoteAddr() net.Addr { return w.remote }
+
+// asyncWriter is implemented by ResponseWriters whose connection stays open
+// until the work started with async is done, letting a handler reply from
+// the background.
+type asyncWriter interface {
+	async(fn func())
+}
+
+func (w *responseWriter) async(fn func()) {
+	w.pending.Add(1)
+	go func() {
+		defer w.pending.Done()
+		fn()
+	}()
+}
+
+// packetResponseWriter replies to the sender of a datagram. Replies to every
+// sender go through the same encoder, and so share a datagram sized buffer.
+type packetResponseWriter struct {
+	out    *packetSender
+	remote net.Addr
+}
+
+type packetSender struct {
+	mu  sync.Mutex
+	enc *Encoder
+	w   *packetWriter
+}
+
+func (w *packetResponseWriter) Write(p Payload) error {
+	w.out.mu.Lock()
+	defer w.out.mu.Unlock()
+	w.out.w.addr = w.remote
+	return w.out.enc.Encode(p)
+}
+
+func (w *packetResponseWriter) RemoteAddr() net.Addr { return w.remote }
+
 type Server struct {
-	listener net.Listener
-	payloads []Payload
+	network     string
+	addr        string
+	handler     Handler
+	listener    net.Listener
+	packetConn  net.PacketConn // in place of listener for datagram networks
+	logger      *slog.Logger
+	decoderOpts []decoderOption
+	encoderOpts []encoderOption
+	hello       *Hello
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+	shutdown bool
 }
 
+type serverOption func(*Server)
+
 func RunServer() error {
-	return NewServer().Run()
+	s, err := NewServer(HandlerFunc(func(w ResponseWriter, p Payload) {
+		_ = w.Write(p)
+	}))
+	if err != nil {
+		return err
+	}
+	return s.Run()
 }
 
-func NewServer() Server {
-	listener, err := net.Listen("tcp", "127.0.0.1:3000")
+// NewServer starts listening for connections whose payloads are passed to h.
+func NewServer(h Handler, opts ...serverOption) (*Server, error) {
+	if h == nil {
+		return nil, errors.New("handler is required")
+	}
+
+	s := &Server{
+		network: "tcp",
+		addr:    "127.0.0.1:3000",
+		handler: h,
+		logger:  slog.Default(),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if isDatagram(s.network) {
+		if s.hello != nil {
+			return nil, errors.New("handshakes need a stream network")
+		}
+		conn, err := net.ListenPacket(s.network, s.addr)
+		if err != nil {
+			return nil, err
+		}
+		s.packetConn = conn
+		return s, nil
+	}
+
+	listener, err := net.Listen(s.network, s.addr)
 	if err != nil {
-		log.Printf("error starting server: %s", err)
-		os.Exit(1)
+		return nil, err
 	}
-	b1 := Binary("Clear is better than clever")
-	b2 := Binary("Don't panic")
-	s1 := String("errors are values")
-	return Server{
-		listener: listener,
-		payloads: []Payload{&b1, &b2, &s1},
+	s.listener = listener
+
+	return s, nil
+}
+
+// WithNetwork sets the network the server listens on, by default this is
+// tcp. Stream networks such as unix serve each connection like tcp. Datagram
+// networks, udp and unixgram, decode each datagram received with a
+// DatagramDecoder and send each reply as a datagram of its own, back to
+// where the payload came from. Datagrams are handled one at a time in the
+// order they arrive.
+func WithNetwork(network string) serverOption {
+	return func(s *Server) {
+		s.network = network
 	}
 }
 
-func (s Server) Run() error {
-	conn, err := s.listener.Accept()
-	if err != nil {
-		return err
+// WithAddr sets the address the server listens on, by default this is
+// 127.0.0.1:3000.
+func WithAddr(addr string) serverOption {
+	return func(s *Server) {
+		s.addr = addr
+	}
+}
+
+// WithLogger sets the logger used by the server, by default this is
+// slog.Default().
+func WithLogger(l *slog.Logger) serverOption {
+	return func(s *Server) {
+		s.logger = l
+	}
+}
+
+// WithDecoderOptions sets the options for the decoder reading each
+// connection, such as WithMaxTotalSize to cap what a connection can send.
+func WithDecoderOptions(opts ...decoderOption) serverOption {
+	return func(s *Server) {
+		s.decoderOpts = opts
+	}
+}
+
+// WithEncoderOptions sets the options for the encoder writing replies to each
+// connection, such as WithEncoderChecksum.
+func WithEncoderOptions(opts ...encoderOption) serverOption {
+	return func(s *Server) {
+		s.encoderOpts = opts
+	}
+}
+
+// WithHandshake makes the server exchange h with each connection through
+// Handshake before reading any payloads, dropping connections that fail it.
+// The decoder and encoder for the connection then use what was negotiated,
+// along with the options from WithDecoderOptions and WithEncoderOptions.
+func WithHandshake(h Hello) serverOption {
+	return func(s *Server) {
+		s.hello = &h
+	}
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	if s.packetConn != nil {
+		return s.packetConn.LocalAddr()
 	}
+	return s.listener.Addr()
+}
 
-	defer conn.Close()
+// Run accepts connections, serving each on its own goroutine, until Shutdown
+// is called, after which it returns ErrServerClosed.
+func (s *Server) Run() error {
+	s.logger.Info("listening", "network", s.network, "addr", s.Addr().String())
+
+	if s.packetConn != nil {
+		return s.servePackets()
+	}
 
-	for _, p := range s.payloads {
-		_, err := p.WriteTo(conn)
+	for {
+		conn, err := s.listener.Accept()
 		if err != nil {
+			if s.closing() {
+				return ErrServerClosed
+			}
 			return err
 		}
+
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown stops accepting connections and waits for the connections being
+// served to finish. Connections stop reading new payloads, but payloads that
+// have already arrived are still handled. If ctx is done first the remaining
+// connections are closed and ctx's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	err := s.close()
+	for conn := range s.conns {
+		// wake up connections blocked waiting for their next payload
+		_ = conn.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// close stops the server listening.
+func (s *Server) close() error {
+	if s.packetConn == nil {
+		return s.listener.Close()
+	}
+	err := s.packetConn.Close()
+	if s.network == "unixgram" {
+		// unlike a unix listener, this leaves the socket file behind
+		_ = os.Remove(s.Addr().String())
+	}
+	return err
+}
+
+func (s *Server) closing() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdown
+}
+
+// track adds conn to the connections being served, returning false if the
+// server is shutting down.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	s.wg.Done()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer func() { _ = conn.Close() }()
+
+	logger := s.logger.With("remote_addr", conn.RemoteAddr().String())
+	logger.Debug("accepted connection")
+
+	dec := NewDecoder(conn, s.decoderOpts...)
+	w := &responseWriter{enc: NewEncoder(conn, s.encoderOpts...), remote: conn.RemoteAddr()}
+	if s.hello != nil {
+		session, err := s.handshake(conn)
+		if err != nil {
+			logger.Warn("handshake failed", "error", err)
+			return
+		}
+		logger.Debug("negotiated session", "version", session.Version)
+		dec = session.NewDecoder(conn, s.decoderOpts...)
+		w.enc = session.NewEncoder(conn, s.encoderOpts...)
+	}
+	// let handlers still replying in the background finish first
+	defer w.pending.Wait()
+
+	for {
+		p, err := dec.Decode()
+		if err != nil {
+			switch {
+			case errors.Is(err, ErrUnknownType), errors.Is(err, ErrUnsupportedType):
+				logger.Warn("skipping payload", "error", err)
+				continue
+			case errors.Is(err, ErrChecksum):
+				// the decoder finds the next good frame by itself
+				logger.Warn("skipping corrupt frame", "error", err)
+				continue
+			case errors.Is(err, io.EOF), s.closing():
+				logger.Debug("closing connection")
+			default:
+				logger.Error("decoding payload", "error", err)
+			}
+			return
+		}
+
+		s.handler.ServeTLV(w, p)
+	}
+}
+
+// handshakeTimeout bounds how long a connection has to complete the handshake.
+const handshakeTimeout = 10 * time.Second
+
+func (s *Server) handshake(conn net.Conn) (*Session, error) {
+	if !s.setDeadline(conn, time.Now().Add(handshakeTimeout)) {
+		return nil, ErrServerClosed
+	}
+	session, err := Handshake(conn, *s.hello)
+	if err != nil {
+		return nil, err
+	}
+	if !s.setDeadline(conn, time.Time{}) {
+		return nil, ErrServerClosed
+	}
+	return session, nil
+}
+
+// setDeadline sets the deadline of conn, returning false instead if the
+// server is shutting down so the deadline Shutdown set is kept.
+func (s *Server) setDeadline(conn net.Conn, t time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shutdown {
+		return false
+	}
+	_ = conn.SetDeadline(t)
+	return true
+}
+
+// servePackets reads datagrams until Shutdown is called, handing the payloads
+// in each to the handler.
+func (s *Server) servePackets() error {
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	dec := NewDatagramDecoder(s.packetConn, s.decoderOpts...)
+	out := &packetSender{w: &packetWriter{conn: s.packetConn}}
+	out.enc = NewEncoder(out.w, append([]encoderOption{WithDatagrams(MaxDatagramSize)}, s.encoderOpts...)...)
+
+	for {
+		p, addr, err := dec.Decode()
+		if err != nil {
+			if addr == nil {
+				if s.closing() {
+					return ErrServerClosed
+				}
+				return err
+			}
+			s.logger.Warn("dropping payload", "remote_addr", addr.String(), "error", err)
+			continue
+		}
+
+		s.handler.ServeTLV(&packetResponseWriter{out: out, remote: addr}, p)
 	}
-	return nil
 }
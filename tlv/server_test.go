@@ -0,0 +1,185 @@
+package tlv_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func newServer(t *testing.T, h tlv.Handler) *tlv.Server {
+	t.Helper()
+
+	s, err := tlv.NewServer(h,
+		tlv.WithAddr("127.0.0.1:0"),
+		tlv.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- s.Run() }()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+		if err := <-errs; !errors.Is(err, tlv.ErrServerClosed) {
+			t.Errorf("expected ErrServerClosed from Run, got %v", err)
+		}
+	})
+
+	return s
+}
+
+var echo = tlv.HandlerFunc(func(w tlv.ResponseWriter, p tlv.Payload) {
+	_ = w.Write(p)
+})
+
+func TestServerHandlesConcurrentClients(t *testing.T) {
+	s := newServer(t, echo)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			conn, err := net.Dial("tcp", s.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer func() { _ = conn.Close() }()
+
+			enc, dec := tlv.NewEncoder(conn), tlv.NewDecoder(conn)
+			for j := 0; j < 5; j++ {
+				want := tlv.String(fmt.Sprintf("client %d message %d", i, j))
+				if err := enc.Encode(&want); err != nil {
+					t.Error(err)
+					return
+				}
+				got, err := dec.Decode()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if got.String() != string(want) {
+					t.Errorf("expected %q, got %q", want, got)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestServerShutdownDrainsInFlightPayloads(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s, err := tlv.NewServer(tlv.HandlerFunc(func(w tlv.ResponseWriter, p tlv.Payload) {
+		close(started)
+		<-release
+		_ = w.Write(p)
+	}),
+		tlv.WithAddr("127.0.0.1:0"),
+		tlv.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Run() }()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	want := tlv.String("slow")
+	if err := tlv.NewEncoder(conn).Encode(&want); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+
+	select {
+	case err := <-shutdown:
+		t.Fatalf("expected Shutdown to wait for the handler, returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, err = net.Dial("tcp", s.Addr().String())
+	if err == nil {
+		t.Error("expected new connections to be refused during shutdown")
+	}
+
+	close(release)
+
+	got, err := tlv.NewDecoder(conn).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != string(want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if err := <-shutdown; err != nil {
+		t.Errorf("expected a clean shutdown, got %v", err)
+	}
+}
+
+func TestServerShutdownGivesUpWhenContextIsDone(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	s, err := tlv.NewServer(tlv.HandlerFunc(func(w tlv.ResponseWriter, p tlv.Payload) {
+		<-release
+	}),
+		tlv.WithAddr("127.0.0.1:0"),
+		tlv.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Run() }()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	p := tlv.String("stuck")
+	if err := tlv.NewEncoder(conn).Encode(&p); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = s.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestNewServerReturnsListenErrors(t *testing.T) {
+	s := newServer(t, echo)
+
+	_, err := tlv.NewServer(echo, tlv.WithAddr(s.Addr().String()))
+	if err == nil {
+		t.Error("expected an error listening on an address in use")
+	}
+}
@@ -0,0 +1,206 @@
+package tlv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Stream is a frame whose body is copied from R as it's written rather than
+// held in memory, for values too large to buffer. On the wire it is an
+// ordinary frame of type Typ, so a Stream of BinaryType can be decoded as a
+// Binary by a peer that doesn't stream.
+type Stream struct {
+	Typ  uint8
+	Size uint64 // the number of bytes R produces
+	R    io.Reader
+}
+
+// NewStream returns a Stream of BinaryType with the size bytes read from r.
+func NewStream(r io.Reader, size uint64) *Stream {
+	return &Stream{Typ: BinaryType, Size: size, R: r}
+}
+
+// WriteTo writes the frame header to w followed by the body copied from R.
+// Streams aren't held to MaxPayloadSize, the peer decides what it accepts,
+// but only an Encoder using the varint header can send more than 4GB.
+func (s *Stream) WriteTo(w io.Writer) (int64, error) {
+	if s.Size > math.MaxUint32 {
+		return 0, s.tooLarge()
+	}
+	n, err := w.Write(appendHeader(nil, uint64(s.Typ), s.Size, false))
+	if err != nil {
+		return int64(n), err
+	}
+
+	o, err := s.copyBody(w)
+	return int64(n) + o, err
+}
+
+func (s *Stream) tooLarge() error {
+	return fmt.Errorf("%w: a %d byte stream needs the varint header", ErrMaxPayloadSize, s.Size)
+}
+
+// copyBody copies exactly Size bytes from R to w. R running out early leaves
+// a truncated frame behind, so it's reported as io.ErrUnexpectedEOF.
+func (s *Stream) copyBody(w io.Writer) (int64, error) {
+	n, err := io.CopyN(w, s.R, int64(s.Size))
+	return n, unexpectedEOF(err)
+}
+
+// EncodeStream writes s as a single frame, copying its body from s.R. The
+// frame may be written in several pieces, unless WithDatagrams is used.
+func (e *Encoder) EncodeStream(s *Stream) error {
+	err := e.check(s.Typ)
+	if err != nil {
+		return err
+	}
+	if !e.varint && s.Size > math.MaxUint32 {
+		return s.tooLarge()
+	}
+
+	header := e.header(uint64(s.Typ), s.Size)
+	err = e.fits(len(header) + int(s.Size))
+	if err != nil {
+		return err
+	}
+
+	err = e.writeStream(header, s)
+	if err != nil && e.datagram > 0 {
+		// don't send what there is of the frame with the next datagram
+		e.w.Reset(e.dst)
+	}
+	return err
+}
+
+func (e *Encoder) writeStream(header []byte, s *Stream) error {
+	_, err := e.w.Write(header)
+	if err != nil {
+		return err
+	}
+
+	if !e.checksum {
+		_, err = s.copyBody(e.w)
+		if err != nil {
+			return err
+		}
+		return e.w.Flush()
+	}
+
+	sum := crc32.New(castagnoli)
+	_, err = s.copyBody(io.MultiWriter(e.w, sum))
+	if err != nil {
+		return err
+	}
+	err = e.writeChecksum(sum.Sum32())
+	if err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// DecodeStream reads the next frame header and returns a Stream whose R reads
+// the body straight from the underlying reader, whatever the frame's type.
+// Compressed frames are returned as they are, as are Extended ones, with the
+// type of a varint header folded into the body. Frames of types rejected by
+// WithTypes are handled as by Decode. The body isn't held to the decoder's
+// MaxPayloadSize, though it counts towards its MaxTotalSize.
+//
+// R is only valid until the next call to Decode or DecodeStream, which skip
+// whatever is left of it. With checksums on, R returns an error wrapping
+// ErrChecksum in place of io.EOF if the body doesn't match.
+func (d *Decoder) DecodeStream() (*Stream, error) {
+	var trailer int64
+	if d.checksum {
+		trailer = ChecksumSize
+	}
+
+	typ, sz, err := d.nextHeader(math.MaxUint64)
+	for err == nil && !d.supports(typ) {
+		err = d.discard(int64(sz) + trailer)
+		if err == nil {
+			err = d.unsupported(typ)
+		}
+		if errors.Is(err, errSkipped) {
+			typ, sz, err = d.nextHeader(math.MaxUint64)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.stream = &streamReader{d: d, left: int64(sz)}
+	if d.checksum {
+		d.stream.sum = crc32.New(castagnoli)
+	}
+
+	if typ >= MinExtendedType {
+		prefix := binary.AppendUvarint(nil, typ)
+		r := io.MultiReader(bytes.NewReader(prefix), d.stream)
+		return &Stream{Typ: ExtendedType, Size: uint64(len(prefix)) + sz, R: r}, nil
+	}
+	return &Stream{Typ: uint8(typ), Size: sz, R: d.stream}, nil
+}
+
+// streamReader reads the body of a frame handed out by DecodeStream.
+type streamReader struct {
+	d    *Decoder
+	left int64       // bytes of the body still to be read
+	sum  hash.Hash32 // checksum of the body so far, nil without checksums
+	err  error       // returned once the body has been read
+	done bool
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	if s.done {
+		return 0, s.err
+	}
+	if s.left == 0 {
+		s.done, s.err = true, s.finish()
+		return 0, s.err
+	}
+
+	if int64(len(p)) > s.left {
+		p = p[:s.left]
+	}
+	n, err := s.d.r.Read(p)
+	s.left -= int64(n)
+	s.d.read += int64(n)
+	if s.sum != nil {
+		_, _ = s.sum.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		err = nil
+		if s.left > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	if err != nil {
+		s.done, s.err = true, err
+	}
+	return n, err
+}
+
+// finish reads the checksum following the body, if there is one.
+func (s *streamReader) finish() error {
+	if s.sum == nil {
+		return io.EOF
+	}
+
+	var sum [ChecksumSize]byte
+	n, err := readFull(s.d.r, sum[:])
+	s.d.read += int64(n)
+	if err != nil {
+		return err
+	}
+	if s.sum.Sum32() != binary.BigEndian.Uint32(sum[:]) {
+		return fmt.Errorf("%w: frame body", ErrChecksum)
+	}
+	return io.EOF
+}
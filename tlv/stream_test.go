@@ -0,0 +1,135 @@
+package tlv_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func TestStreamLargerThanMaxPayloadSize(t *testing.T) {
+	const size = 3 * uint64(tlv.MaxPayloadSize)
+
+	want := sha256.New()
+	src := io.TeeReader(io.LimitReader(rand.New(rand.NewSource(1)), int64(size)), want)
+
+	r, w := io.Pipe()
+	go func() {
+		err := tlv.NewEncoder(w).EncodeStream(tlv.NewStream(src, size))
+		_ = w.CloseWithError(err)
+	}()
+
+	s, err := tlv.NewDecoder(r).DecodeStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Typ != tlv.BinaryType || s.Size != size {
+		t.Errorf("expected a %d byte Binary, got type %d of %d bytes", size, s.Typ, s.Size)
+	}
+
+	got := sha256.New()
+	n, err := io.Copy(got, s.R)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(size) || !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+		t.Errorf("expected the %d bytes sent, got %d different ones", size, n)
+	}
+}
+
+func TestStreamIsAnOrdinaryFrame(t *testing.T) {
+	var buf bytes.Buffer
+	enc := tlv.NewEncoder(&buf)
+	if err := enc.EncodeStream(tlv.NewStream(strings.NewReader("streamed"), 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(ptr(tlv.String("buffered"))); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := tlv.NewDecoder(&buf)
+	for _, want := range []string{"streamed", "buffered"} {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestDecodeSkipsUnreadStream(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		var buf bytes.Buffer
+		enc, dec := tlv.NewEncoder(&buf), tlv.NewDecoder(&buf)
+		if checksum {
+			enc, dec = tlv.NewEncoder(&buf, tlv.WithEncoderChecksum()), tlv.NewDecoder(&buf, tlv.WithChecksum())
+		}
+
+		if err := enc.EncodeStream(tlv.NewStream(strings.NewReader("mostly unread"), 13)); err != nil {
+			t.Fatal(err)
+		}
+		if err := enc.Encode(ptr(tlv.String("next"))); err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := dec.DecodeStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(s.R, make([]byte, 6)); err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("checksum %t: %v", checksum, err)
+		}
+		if got.String() != "next" {
+			t.Errorf("checksum %t: expected next, got %q", checksum, got)
+		}
+	}
+}
+
+func TestStreamChecksumMismatch(t *testing.T) {
+	var buf bytes.Buffer
+	err := tlv.NewEncoder(&buf, tlv.WithEncoderChecksum()).
+		EncodeStream(tlv.NewStream(strings.NewReader("checked"), 7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Bytes()[tlv.HeaderSize+tlv.ChecksumSize] ^= 1
+
+	s, err := tlv.NewDecoder(&buf, tlv.WithChecksum()).DecodeStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(s.R)
+	if !errors.Is(err, tlv.ErrChecksum) {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+}
+
+func TestStreamShortReader(t *testing.T) {
+	err := tlv.NewEncoder(io.Discard).EncodeStream(tlv.NewStream(strings.NewReader("short"), 10))
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	// a frame cut off part way through its body
+	frame := encode(t, ptr(tlv.Binary("cut off")))
+	s, err := tlv.NewDecoder(bytes.NewReader(frame[:len(frame)-2])).DecodeStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.ReadAll(s.R)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
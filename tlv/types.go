@@ -1,7 +1,7 @@
 package tlv
 
 import (
-	"encoding/binary"
+	"encoding"
 	"errors"
 	"fmt"
 	"io"
@@ -10,134 +10,84 @@ import (
 const (
 	BinaryType uint8 = iota + 1
 	StringType
+	Int8Type
+	Int16Type
+	Int32Type
+	Int64Type
+	Uint8Type
+	Uint16Type
+	Uint32Type
+	Uint64Type
+	VarintType
+	UvarintType
+	Float64Type
+	BoolType
+	TimestampType
+	ListType
+	MapType
+	RecordType
+	CallType
+	ReplyType
+	ErrorType
+	CompressedType
+	ExtendedType
 
 	MaxPayloadSize uint32 = 10 << 20 // 10MB
+	MaxDepth              = 32       // how deeply Lists, Maps and Records may nest
 )
 
-var ErrMaxPayloadSize = errors.New("maximum payload size exceeded")
+var (
+	ErrMaxPayloadSize = errors.New("maximum payload size exceeded")
+	ErrMaxDepth       = errors.New("maximum nesting depth exceeded")
+	ErrInvalidPayload = errors.New("invalid payload")
+)
 
 type Payload interface {
 	fmt.Stringer
 	io.ReaderFrom
 	io.WriterTo
-	Bytes() []byte
+	encoding.BinaryUnmarshaler // sets the value from the body of a frame
+
+	Bytes() []byte // the value as it appears in the body of a frame
+	Type() uint8
 }
 
 type Binary []byte
 
 func (m *Binary) Bytes() []byte  { return *m }
 func (m *Binary) String() string { return string(*m) }
+func (m *Binary) Type() uint8    { return BinaryType }
 
 func (m *Binary) WriteTo(w io.Writer) (int64, error) {
-	err := binary.Write(w, binary.BigEndian, BinaryType) // 1-byte type
-	if err != nil {
-		return 0, err
-	}
-
-	var n int64 = 1
-
-	err = binary.Write(w, binary.BigEndian, uint32(len(*m))) // 4-byte size
-
-	if err != nil {
-		return n, err
-	}
-
-	n += 4
-
-	o, err := w.Write(*m) // payload
-
-	return n + int64(o), err
+	return WriteFrame(w, m)
 }
 
 func (m *Binary) ReadFrom(r io.Reader) (int64, error) {
-	var typ uint8
-
-	err := binary.Read(r, binary.BigEndian, &typ) // 1-byte type
-	if err != nil {
-		return 0, err
-	}
-
-	if typ != BinaryType {
-		return 0, errors.New("invalid Binary")
-	}
-
-	var n int64 = 1
-
-	var sz uint32
-	err = binary.Read(r, binary.BigEndian, &sz) // 4-byte size
-	if err != nil {
-		return n, err
-	}
-
-	n += 4
-
-	if sz > MaxPayloadSize {
-		return n, ErrMaxPayloadSize
-	}
-	*m = make([]byte, sz)
-	o, err := r.Read(*m) // payload
+	return ReadFrame(r, m)
+}
 
-	return n + int64(o), err
+func (m *Binary) UnmarshalBinary(data []byte) error {
+	*m = append((*m)[:0], data...)
+	return nil
 }
 
 type String string
 
 func (m String) Bytes() []byte  { return []byte(m) }
 func (m String) String() string { return string(m) }
+func (m String) Type() uint8    { return StringType }
 
 func (m String) WriteTo(w io.Writer) (int64, error) {
-	err := binary.Write(w, binary.BigEndian, StringType) // 1-byte type
-	if err != nil {
-		return 0, err
-	}
-
-	var n int64 = 1
-
-	err = binary.Write(w, binary.BigEndian, uint32(len(m))) // 4-byte size
-	if err != nil {
-		return n, err
-	}
-
-	n += 4
-
-	o, err := w.Write(m.Bytes())
-
-	return n + int64(o), err
+	return writeAppended(w, m)
 }
 
 func (m *String) ReadFrom(r io.Reader) (int64, error) {
-	var typ uint8
-
-	err := binary.Read(r, binary.BigEndian, &typ) // 1-byte size
-	if err != nil {
-		return 0, err
-	}
-
-	if typ != StringType {
-		return 0, errors.New("invalid String")
-	}
-
-	var n int64 = 1
-
-	var sz uint32
-	err = binary.Read(r, binary.BigEndian, &sz) // 4-byte size
-	if err != nil {
-		return n, err
-	}
-
-	n += 4
-
-	if sz > MaxPayloadSize {
-		return n, ErrMaxPayloadSize
-	}
-
-	buf := make([]byte, sz)
-	o, err := r.Read(buf)
-	if err != nil {
-		return n, err
-	}
+	return ReadFrame(r, m)
+}
 
-	*m = String(buf)
+func (m String) appendBody(b []byte) []byte { return append(b, m...) }
 
-	return n + int64(o), nil
+func (m *String) UnmarshalBinary(data []byte) error {
+	*m = String(data)
+	return nil
 }
@@ -0,0 +1,112 @@
+package tlv_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func encode(t *testing.T, payloads ...tlv.Payload) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for _, p := range payloads {
+		_, err := p.WriteTo(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadFromReadsWholePayloadFromSlowReaders(t *testing.T) {
+	b := tlv.Binary(bytes.Repeat([]byte("Clear is better than clever. "), 100))
+	s := tlv.String("errors are values")
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"OneByteReader": iotest.OneByteReader,
+		"HalfReader":    iotest.HalfReader,
+		"DataErrReader": iotest.DataErrReader,
+	}
+
+	for name, wrap := range readers {
+		t.Run(name, func(t *testing.T) {
+			r := wrap(bytes.NewReader(encode(t, &b, &s, &b)))
+
+			var (
+				gotB1, gotB2 tlv.Binary
+				gotS         tlv.String
+			)
+
+			for _, p := range []tlv.Payload{&gotB1, &gotS, &gotB2} {
+				_, err := p.ReadFrom(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if !bytes.Equal(gotB1, b) || !bytes.Equal(gotB2, b) {
+				t.Errorf("expected Binary payloads to equal %q, got %q and %q", b, gotB1, gotB2)
+			}
+			if gotS != s {
+				t.Errorf("expected %q, got %q", s, gotS)
+			}
+		})
+	}
+}
+
+func TestReadFromReportsTruncatedFrames(t *testing.T) {
+	b := tlv.Binary("Don't panic")
+	s := tlv.String("Don't panic")
+
+	tests := []struct {
+		name    string
+		encoded []byte
+		payload tlv.Payload
+	}{
+		{name: "Binary", encoded: encode(t, &b), payload: new(tlv.Binary)},
+		{name: "String", encoded: encode(t, &s), payload: new(tlv.String)},
+	}
+
+	for _, tt := range tests {
+		// cut the frame inside the size and inside the payload, a partially
+		// read size isn't counted in the bytes read
+		for _, cut := range []int{1, 3, 5, len(tt.encoded) - 1} {
+			r := iotest.HalfReader(bytes.NewReader(tt.encoded[:cut]))
+
+			n, err := tt.payload.ReadFrom(r)
+			if !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Errorf("%s cut at %d: expected io.ErrUnexpectedEOF, got %v", tt.name, cut, err)
+			}
+			if cut >= 5 && n != int64(cut) {
+				t.Errorf("%s cut at %d: expected %d bytes read, got %d", tt.name, cut, cut, n)
+			}
+		}
+	}
+}
+
+func TestReadFromReturnsEOFOnEmptyStream(t *testing.T) {
+	var b tlv.Binary
+
+	_, err := b.ReadFrom(bytes.NewReader(nil))
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestReadFromRejectsOversizedPayloads(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteByte(tlv.BinaryType)
+	_ = binary.Write(&buf, binary.BigEndian, tlv.MaxPayloadSize+1)
+
+	var b tlv.Binary
+	_, err := b.ReadFrom(&buf)
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize, got %v", err)
+	}
+}
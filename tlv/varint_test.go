@@ -0,0 +1,198 @@
+package tlv_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jm96441n/networkProgrammingInGo/tlv"
+)
+
+func TestVarintHeaderRoundTrip(t *testing.T) {
+	payloads := []tlv.Payload{
+		ptr(tlv.String("hi")),
+		ptr(tlv.Binary(bytes.Repeat([]byte{7}, 300))),
+		&tlv.Extended{Typ: 1 << 20, Body: []byte("wide")},
+		&tlv.Record{{Tag: 1, Value: ptr(tlv.Bool(true))}},
+	}
+
+	for _, checksum := range []bool{false, true} {
+		var buf bytes.Buffer
+		enc := tlv.NewEncoder(&buf, tlv.WithEncoderVarintHeader())
+		dec := tlv.NewDecoder(&buf, tlv.WithVarintHeader())
+		if checksum {
+			enc = tlv.NewEncoder(&buf, tlv.WithEncoderVarintHeader(), tlv.WithEncoderChecksum())
+			dec = tlv.NewDecoder(&buf, tlv.WithVarintHeader(), tlv.WithChecksum())
+		}
+
+		for _, p := range payloads {
+			if err := enc.Encode(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, want := range payloads {
+			got, err := dec.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("checksum %t: expected %v, got %v", checksum, want, got)
+			}
+		}
+		if _, err := dec.Decode(); err != io.EOF {
+			t.Errorf("expected io.EOF, got %v", err)
+		}
+	}
+}
+
+func TestVarintHeaderIsCompact(t *testing.T) {
+	var buf bytes.Buffer
+	if err := tlv.NewEncoder(&buf, tlv.WithEncoderVarintHeader()).Encode(ptr(tlv.String("hi"))); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{tlv.StringType, 2, 'h', 'i'}; !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("expected % x, got % x", want, buf.Bytes())
+	}
+}
+
+func TestExtendedWithFixedHeader(t *testing.T) {
+	want := &tlv.Extended{Typ: 300, Body: []byte("body")}
+
+	var buf bytes.Buffer
+	if err := tlv.NewEncoder(&buf).Encode(want); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Bytes()[0] != tlv.ExtendedType {
+		t.Fatalf("expected a frame of ExtendedType, got type %d", buf.Bytes()[0])
+	}
+	wire := buf.Bytes()
+
+	// either layout's decoder reads the generic form
+	for _, dec := range []*tlv.Decoder{
+		tlv.NewDecoder(bytes.NewReader(wire)),
+		tlv.NewDecoder(bytes.NewReader(append([]byte{tlv.ExtendedType, byte(len(wire) - tlv.HeaderSize)}, wire[tlv.HeaderSize:]...)), tlv.WithVarintHeader()),
+	} {
+		got, err := dec.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v, got %v", want, got)
+		}
+	}
+
+	if err := new(tlv.Extended).UnmarshalBinary([]byte{5}); !errors.Is(err, tlv.ErrInvalidPayload) {
+		t.Errorf("expected ErrInvalidPayload for a type below MinExtendedType, got %v", err)
+	}
+}
+
+func TestVarintHeaderStreamsPast4GB(t *testing.T) {
+	const size = 5 << 30
+
+	err := tlv.NewEncoder(io.Discard).EncodeStream(tlv.NewStream(nil, size))
+	if !errors.Is(err, tlv.ErrMaxPayloadSize) {
+		t.Errorf("expected ErrMaxPayloadSize from the fixed header, got %v", err)
+	}
+
+	// a header claiming more than 4GB, followed by the start of the body
+	wire := binary.AppendUvarint([]byte{tlv.BinaryType}, size)
+	wire = append(wire, "start"...)
+
+	dec := tlv.NewDecoder(bytes.NewReader(wire), tlv.WithVarintHeader())
+	s, err := dec.DecodeStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size != size {
+		t.Errorf("expected a %d byte stream, got %d", uint64(size), s.Size)
+	}
+	body, err := io.ReadAll(s.R)
+	if !errors.Is(err, io.ErrUnexpectedEOF) || string(body) != "start" {
+		t.Errorf("expected the start of the body then io.ErrUnexpectedEOF, got %q, %v", body, err)
+	}
+}
+
+func TestVarintHeaderRejectsHugeSizes(t *testing.T) {
+	wire := binary.AppendUvarint([]byte{tlv.BinaryType}, 1<<63)
+	wire = append(wire, 'x')
+	dec := tlv.NewDecoder(bytes.NewReader(wire), tlv.WithVarintHeader())
+	if _, err := dec.DecodeStream(); !errors.Is(err, tlv.ErrInvalidPayload) {
+		t.Errorf("expected ErrInvalidPayload for a size past math.MaxInt64, got %v", err)
+	}
+
+	// a size that would wrap around when added to what's been read
+	wire = binary.AppendUvarint([]byte{tlv.BinaryType}, 1<<63-1)
+	dec = tlv.NewDecoder(bytes.NewReader(wire), tlv.WithVarintHeader(), tlv.WithMaxTotalSize(1<<20))
+	if _, err := dec.DecodeStream(); !errors.Is(err, tlv.ErrMaxTotalSize) {
+		t.Errorf("expected ErrMaxTotalSize, got %v", err)
+	}
+}
+
+func TestVarintHeaderResynchronizes(t *testing.T) {
+	var buf bytes.Buffer
+	enc := tlv.NewEncoder(&buf, tlv.WithEncoderVarintHeader(), tlv.WithEncoderChecksum())
+	for _, s := range []string{"lost", "found"} {
+		if err := enc.Encode(ptr(tlv.String(s))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wire := buf.Bytes()
+	wire[1] ^= 0xff // the size of the first frame
+
+	dec := tlv.NewDecoder(bytes.NewReader(wire), tlv.WithVarintHeader(), tlv.WithChecksum())
+	if _, err := dec.Decode(); !errors.Is(err, tlv.ErrChecksum) {
+		t.Fatalf("expected ErrChecksum, got %v", err)
+	}
+	p, err := dec.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != "found" {
+		t.Errorf("expected found, got %q", p)
+	}
+}
+
+func TestVarintHeaderOverConn(t *testing.T) {
+	for _, checksum := range []bool{false, true} {
+		server, client := net.Pipe()
+		_ = client.SetDeadline(time.Now().Add(time.Second))
+
+		pipe := func(c net.Conn) (*tlv.Encoder, *tlv.Decoder) {
+			if checksum {
+				return tlv.NewEncoder(c, tlv.WithEncoderVarintHeader(), tlv.WithEncoderChecksum()),
+					tlv.NewDecoder(c, tlv.WithVarintHeader(), tlv.WithChecksum())
+			}
+			return tlv.NewEncoder(c, tlv.WithEncoderVarintHeader()), tlv.NewDecoder(c, tlv.WithVarintHeader())
+		}
+
+		// a frame far smaller than the largest varint header is decoded
+		// without waiting on bytes that never come
+		go func() {
+			defer server.Close()
+			enc, dec := pipe(server)
+			p, err := dec.Decode()
+			if err != nil {
+				return
+			}
+			_ = enc.Encode(p)
+		}()
+
+		enc, dec := pipe(client)
+		if err := enc.Encode(ptr(tlv.String("hi"))); err != nil {
+			t.Fatal(err)
+		}
+		p, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("checksum %t: %v", checksum, err)
+		}
+		if p.String() != "hi" {
+			t.Errorf("expected hi, got %q", p)
+		}
+		client.Close()
+	}
+}
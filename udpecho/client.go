@@ -4,11 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net"
-
-	"github.com/charmbracelet/log"
 )
 
-func RunClient(ctx context.Context, serverAddr, clientAddr string, numMsgs int, cancel context.CancelFunc) error {
+func RunClient(ctx context.Context, serverAddr, clientAddr string, numMsgs int, cancel context.CancelFunc, opts ...option) error {
+	cfg := newConfig(opts)
+
 	client, err := net.ListenPacket("udp", clientAddr)
 	if err != nil {
 		return err
@@ -33,7 +33,7 @@ func RunClient(ctx context.Context, serverAddr, clientAddr string, numMsgs int,
 			return err
 		}
 
-		log.Info(fmt.Sprintf("Received %q from %q", buf[:n], server.String()))
+		cfg.logger.Info("received", "data", string(buf[:n]), "remote_addr", server.String())
 	}
 	return nil
 }
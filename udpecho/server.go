@@ -3,12 +3,35 @@ package udpecho
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net"
-
-	"github.com/charmbracelet/log"
 )
 
-func RunServer(ctx context.Context, addr string, numMsgs int, cancel context.CancelFunc) error {
+type config struct {
+	logger *slog.Logger
+}
+
+type option func(*config)
+
+// WithLogger sets the logger used by RunServer and RunClient, by default this
+// is slog.Default().
+func WithLogger(l *slog.Logger) option {
+	return func(c *config) {
+		c.logger = l
+	}
+}
+
+func newConfig(opts []option) config {
+	c := config{logger: slog.Default()}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+func RunServer(ctx context.Context, addr string, numMsgs int, cancel context.CancelFunc, opts ...option) error {
+	cfg := newConfig(opts)
+
 	s, err := net.ListenPacket("udp", addr)
 	if err != nil {
 		return fmt.Errorf("binding to udp %s: %w", addr, err)
@@ -20,19 +43,19 @@ func RunServer(ctx context.Context, addr string, numMsgs int, cancel context.Can
 		for {
 			n, clientAddr, err := s.ReadFrom(buf) // client to server
 			if err != nil {
-				log.Error(err)
+				cfg.logger.Error("read", "error", err)
 				return
 			}
 
-			log.Info(fmt.Sprintf("Received %q from %q", buf[:n], clientAddr.String()))
+			cfg.logger.Info("received", "data", string(buf[:n]), "remote_addr", clientAddr.String())
 			_, err = s.WriteTo(buf[:n], clientAddr)
 			if err != nil {
-				log.Error(err)
+				cfg.logger.Error("write", "remote_addr", clientAddr.String(), "error", err)
 				return
 			}
 			i += 1
 			if numMsgs == i {
-				log.Info("Finished Receiving")
+				cfg.logger.Info("finished receiving", "messages", i)
 				cancelFn()
 			}
 		}